@@ -14,6 +14,7 @@ import (
 	"golang.org/x/tools/gopls/internal/test/compare"
 	. "golang.org/x/tools/gopls/internal/test/integration"
 	"golang.org/x/tools/gopls/internal/util/bug"
+	"golang.org/x/tools/gopls/internal/util/slices"
 
 	"golang.org/x/tools/gopls/internal/protocol"
 	"golang.org/x/tools/gopls/internal/protocol/command"
@@ -74,6 +75,88 @@ const (
 	}
 }
 
+func TestRunTestCodeLensPosition(t *testing.T) {
+	const files = `
+-- go.mod --
+module codelens.test
+
+go 1.12
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func helper() {}
+
+func TestLib(t *testing.T) {
+	helper()
+}
+`
+	WithOptions(
+		Settings{"codelenses": map[string]bool{string(settings.CodeLensTest): true}},
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("lib_test.go")
+		line := env.RegexpSearch("lib_test.go", "func TestLib").Range.Start.Line
+		var titles []string
+		for _, lens := range env.CodeLensAt("lib_test.go", line) {
+			titles = append(titles, lens.Command.Title)
+		}
+		if !slices.Contains(titles, "run test") {
+			t.Errorf("code lenses at line %d: got %q, want a %q lens", line, titles, "run test")
+		}
+		if lenses := env.CodeLensAt("lib_test.go", line-2); len(lenses) > 0 {
+			t.Errorf("got unexpected code lenses above helper: %v", lenses)
+		}
+	})
+}
+
+func TestCancelRunTests(t *testing.T) {
+	const files = `
+-- go.mod --
+module codelens.test
+
+go 1.12
+-- lib_test.go --
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlow(t *testing.T) {
+	time.Sleep(10 * time.Minute)
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		cmd, err := command.NewRunTestsCommand("run test", command.RunTestsArgs{
+			URI:   env.Sandbox.Workdir.URI("lib_test.go"),
+			Tests: []string{"TestSlow"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.ExecuteCommand(&protocol.ExecuteCommandParams{
+			Command:   cmd.Command,
+			Arguments: cmd.Arguments,
+		}, nil)
+		token := env.AwaitProgressToken("Running go test")
+		// Cancel only once the test is running, so that cancellation
+		// interrupts go test rather than its setup.
+		env.Await(OutstandingWork("Running go test", "=== RUN   TestSlow"))
+
+		// TestSlow would run for ten minutes; cancellation must end it early.
+		// (gopls reports the interrupted go test as a failure, not as
+		// canceled, so don't assert on the particular message.)
+		env.CancelProgress(token)
+		var status WorkStatus
+		env.Await(CompletedProgress(token, &status))
+		if status.EndMsg == server.CommandCompleted {
+			t.Errorf("after cancellation, go test ended with %q", status.EndMsg)
+		}
+	})
+}
+
 const proxyWithLatest = `
 -- golang.org/x/hello@v1.3.3/go.mod --
 module golang.org/x/hello
@@ -368,6 +451,43 @@ require golang.org/x/hello v1.0.0
 	})
 }
 
+func TestResetGoModDiagnostics(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.14
+
+require golang.org/x/hello v1.2.3
+-- go.sum --
+golang.org/x/hello v1.2.3 h1:7Wesfkx/uBd+eFgPrq0irYj/1XfmbvLV8jZ/W7C2Dwg=
+golang.org/x/hello v1.2.3/go.mod h1:OgtlzsxVMUUdsdQCIDYgaauCTH47B8T8vofouNJfzgY=
+-- main.go --
+package main
+
+import "golang.org/x/hello/hi"
+
+func main() {
+	_ = hi.Goodbye
+}
+`
+	WithOptions(
+		ProxyFiles(proxyWithLatest),
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("go.mod")
+		env.ExecuteCodeLensCommand("go.mod", command.CheckUpgrades, nil)
+		env.OnceMet(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromCheckUpgrades), 1, true),
+			Diagnostics(env.AtRegexp("go.mod", `require`), WithMessage("can be upgraded")),
+		)
+		env.ResetGoModDiagnostics("go.mod")
+		env.OnceMet(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromResetGoModDiagnostics), 1, true),
+			NoDiagnostics(ForFile("go.mod")),
+		)
+	})
+}
+
 func TestRegenerateCgo(t *testing.T) {
 	testenv.NeedsTool(t, "cgo")
 	const workspace = `
@@ -79,6 +79,93 @@ func f(x int) *int { return &x }`)
 	})
 }
 
+func TestToggleCompilerOptDetails(t *testing.T) {
+	if runtime.GOOS == "android" {
+		t.Skipf("the gc details code lens doesn't work on Android")
+	}
+
+	const mod = `
+-- go.mod --
+module mod.com
+
+go 1.15
+-- a/a.go --
+package a
+
+func f() int { return 1 }
+
+func g() int {
+	return f()
+}
+`
+	Run(t, mod, func(t *testing.T, env *Env) {
+		env.ToggleCompilerOptDetails("a")
+		env.OnceMet(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromToggleGCDetails), 1, true),
+			Diagnostics(
+				env.AtRegexp("a/a.go", "func (f)"),
+				WithMessage("canInlineFunction"),
+				WithSeverityTags("optimizer details", protocol.SeverityInformation, nil),
+			),
+		)
+
+		env.ToggleCompilerOptDetails("a")
+		env.OnceMet(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromToggleGCDetails), 2, true),
+			NoDiagnostics(ForFile("a/a.go")),
+		)
+	})
+}
+
+// Test that the compiler optimization details toggle is session state,
+// which persists when the package's files are closed and reopened.
+func TestToggleCompilerOptDetails_Reopen(t *testing.T) {
+	if runtime.GOOS == "android" {
+		t.Skipf("the gc details code lens doesn't work on Android")
+	}
+
+	const mod = `
+-- go.mod --
+module mod.com
+
+go 1.15
+-- a/a.go --
+package a
+
+func f() int { return 1 }
+
+func g() int {
+	return f()
+}
+`
+	Run(t, mod, func(t *testing.T, env *Env) {
+		if env.Editor.CompilerOptDetailsEnabled("a") {
+			t.Fatal("compiler optimization details enabled before toggling")
+		}
+		env.OpenFile("a/a.go")
+		env.ToggleCompilerOptDetails("a")
+		if !env.Editor.CompilerOptDetailsEnabled("a") {
+			t.Fatal("compiler optimization details not enabled after toggling")
+		}
+		optDetails := Diagnostics(
+			env.AtRegexp("a/a.go", "func (f)"),
+			WithMessage("canInlineFunction"),
+			WithSeverityTags("optimizer details", protocol.SeverityInformation, nil),
+		)
+		env.OnceMet(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromToggleGCDetails), 1, true),
+			optDetails,
+		)
+
+		env.CloseBuffer("a/a.go")
+		env.OpenFile("a/a.go")
+		env.AfterChange(optDetails)
+		if !env.Editor.CompilerOptDetailsEnabled("a/") {
+			t.Error("compiler optimization details not enabled after reopening")
+		}
+	})
+}
+
 // Test for the crasher in golang/go#54199
 func TestGCDetails_NewFile(t *testing.T) {
 	bug.PanicOnBugs = false
@@ -510,6 +510,37 @@ func doit() {
 	})
 }
 
+func TestDeprecatedCompletions(t *testing.T) {
+	const files = `
+-- go.mod --
+module test.com
+
+go 1.16
+-- lib/lib.go --
+package lib
+
+// Deprecated: use New.
+func Old() {}
+
+func New() {}
+-- main.go --
+package main
+
+import "test.com/lib"
+
+func main() {
+	lib.
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		loc := env.RegexpSearch("main.go", `lib\.()`)
+		if diff := compareCompletionLabels([]string{"Old"}, env.DeprecatedCompletions(loc)); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
+
 func TestUnimportedCompletion_VSCodeIssue1489(t *testing.T) {
 	const src = `
 -- go.mod --
@@ -734,6 +765,50 @@ func main() {
 	})
 }
 
+// Test that accepting an unimported completion applies its additional import
+// edit, which precedes the insertion point, along with the main edit.
+func TestUnimportedCompletionAdditionalEdits(t *testing.T) {
+	const src = `
+-- go.mod --
+module mod.com
+
+go 1.14
+
+-- main.go --
+package main
+
+func main() {
+	_ = strings.ToUpp
+}
+`
+	Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.Await(env.DoneWithOpen())
+		loc := env.RegexpSearch("main.go", "ToUpp()")
+		completions := env.Completion(loc)
+		var item *protocol.CompletionItem
+		for i := range completions.Items {
+			if completions.Items[i].Label == "ToUpper" {
+				item = &completions.Items[i]
+				break
+			}
+		}
+		if item == nil {
+			t.Fatalf("no ToUpper completion item among %d items", len(completions.Items))
+		}
+		if len(item.AdditionalTextEdits) == 0 {
+			t.Fatalf("ToUpper completion has no additional edits")
+		}
+		env.AcceptCompletion(loc, *item)
+		env.AfterChange(NoDiagnostics(ForFile("main.go")))
+		got := env.BufferText("main.go")
+		want := "package main\n\nimport \"strings\"\n\nfunc main() {\n\t_ = strings.ToUpper\n}\n"
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unimported completion (-want +got):\n%s", diff)
+		}
+	})
+}
+
 func TestCompleteAllFields(t *testing.T) {
 	// This test verifies that completion results always include all struct fields.
 	// See golang/go#53992.
@@ -1164,3 +1239,53 @@ func main() {
 		}
 	})
 }
+
+// TestCompletionBudget checks that a finite completion budget truncates the
+// deep completion search, which the fake editor's default unlimited budget
+// would otherwise hide.
+func TestCompletionBudget(t *testing.T) {
+	const src = `
+-- go.mod --
+module mod.com
+
+go 1.18
+
+-- p/p.go --
+package p
+
+type Inner struct{ Deep int }
+
+type Outer struct{ In Inner }
+
+func _() {
+	var o Outer
+	var _ int = o
+}
+`
+	Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("p/p.go")
+		loc := env.RegexpSearch("p/p.go", `var _ int = o()`)
+		hasDeep := func(list *protocol.CompletionList) bool {
+			for _, item := range list.Items {
+				if item.Label == "o.In.Deep" {
+					return true
+				}
+			}
+			return false
+		}
+		if !hasDeep(env.Completion(loc)) {
+			t.Fatalf("unbudgeted completion does not include deep candidate o.In.Deep")
+		}
+		list := env.CompletionWithBudget(loc, time.Nanosecond)
+		if !list.IsIncomplete {
+			t.Errorf("budgeted completion list is not marked incomplete")
+		}
+		if hasDeep(list) {
+			t.Errorf("budgeted completion includes deep candidate o.In.Deep")
+		}
+		// The budget is restored afterwards.
+		if !hasDeep(env.Completion(loc)) {
+			t.Errorf("completion after CompletionWithBudget does not include deep candidate o.In.Deep")
+		}
+	})
+}
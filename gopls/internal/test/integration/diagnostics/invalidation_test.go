@@ -6,10 +6,12 @@ package diagnostics
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"golang.org/x/tools/gopls/internal/protocol"
 	. "golang.org/x/tools/gopls/internal/test/integration"
+	"golang.org/x/tools/gopls/internal/test/integration/fake"
 )
 
 // Test for golang/go#50267: diagnostics should be re-sent after a file is
@@ -52,6 +54,157 @@ func _() {
 	})
 }
 
+// Test that closing a buffer with unsaved errors clears its diagnostics, as
+// the file reverts to its valid content on disk.
+func TestDiagnosticsClearedAfterClose(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.RegexpReplace("main.go", "{}", "{ x := 2 }")
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("main.go", "x")),
+		)
+		env.CloseBuffer("main.go")
+		env.AwaitDiagnosticsCleared("main.go")
+	})
+}
+
+// Test that diagnostics can be awaited for several interdependent files at
+// once.
+func TestAwaitDiagnosticsForFiles(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- a.go --
+package p
+
+func A() { B("not an int") }
+-- b.go --
+package p
+
+func B(x int) {
+	y := x
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		env.OpenFile("b.go")
+		diags := env.AwaitDiagnosticsFor("a.go", "b.go")
+		if len(diags) != 2 {
+			t.Fatalf("AwaitDiagnosticsFor: got diagnostics for %d files, want 2", len(diags))
+		}
+		for path, want := range map[string]string{"a.go": "cannot use", "b.go": "declared and not used"} {
+			found := false
+			for _, d := range diags[path] {
+				if strings.Contains(d.Message, want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: got diagnostics %v, want one containing %q", path, diags[path], want)
+			}
+		}
+	})
+}
+
+// Test that gopls tolerates a duplicate didOpen for an open file, which
+// violates the LSP spec, and continues to serve requests for it.
+func TestDuplicateDidOpen(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {
+	x := 2
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("main.go", "x")),
+		)
+		env.ForceDidOpen("main.go")
+		env.RegexpReplace("main.go", "x := 2", "_ = 2")
+		env.AfterChange(
+			NoDiagnostics(ForFile("main.go")),
+		)
+	})
+}
+
+// Test that gopls tolerates a didClose for a file that was never opened,
+// which violates the LSP spec, and continues to serve requests.
+func TestSpuriousDidClose(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {
+	x := 2
+}
+-- other.go --
+package main
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.ForceDidClose("other.go")
+		env.OpenFile("main.go")
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("main.go", "x")),
+		)
+	})
+}
+
+// Test that gopls correctly applies several incremental content changes
+// sent in a single didChange notification.
+func TestIncrementalChanges(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {
+	x := 2
+	_ = x
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		// Insert a line at the start of the function, and rename only the use
+		// of x, so that the resulting error is on a shifted line.
+		env.EditBufferIncremental("main.go",
+			fake.NewEdit(2, 10, 2, 10, "\n\tprintln()"),
+			fake.NewEdit(4, 5, 4, 6, "y"),
+		)
+		env.AfterChange(
+			Diagnostics(AtPosition("main.go", 5, 5), WithMessage("undefined: y")),
+		)
+		if got, want := env.BufferText("main.go"), "package main\n\nfunc _() {\n\tprintln()\n\tx := 2\n\t_ = y\n}\n"; got != want {
+			t.Errorf("after incremental edits, buffer = %q, want %q", got, want)
+		}
+	})
+}
+
 // Test for the "chatty" diagnostics: gopls should re-send diagnostics for
 // changed files after every file change, even if diagnostics did not change.
 func TestChattyDiagnostics(t *testing.T) {
@@ -139,3 +292,65 @@ func main() {
 		env.AfterChange(Diagnostics(env.AtRegexp("main.go", "Thing")))
 	})
 }
+
+// Test that pushed diagnostics can be awaited for a specific buffer version.
+func TestAwaitPublishedDiagnostics(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		if diags := env.AwaitPublishedDiagnostics("main.go", env.Editor.BufferVersion("main.go")); len(diags) != 0 {
+			t.Fatalf("got diagnostics %v for valid file, want none", diags)
+		}
+		env.RegexpReplace("main.go", "{}", "{ x := 2 }")
+		diags := env.AwaitPublishedDiagnostics("main.go", env.Editor.BufferVersion("main.go"))
+		if len(diags) != 1 || !strings.Contains(diags[0].Message, "declared and not used") {
+			t.Fatalf("got diagnostics %v, want one unused variable error", diags)
+		}
+		if got, ok := env.Editor.PublishedDiagnostics("main.go"); !ok || len(got) != 1 {
+			t.Errorf("PublishedDiagnostics = %v, %t, want the awaited diagnostics", got, ok)
+		}
+		if _, ok := env.Editor.PublishedDiagnostics("other.go"); ok {
+			t.Errorf("PublishedDiagnostics(other.go) reported diagnostics for an unknown file")
+		}
+	})
+}
+
+// Test that the diagnostics published after an edit are reported for the new
+// buffer version, not a stale one.
+func TestDiagnosticsVersion(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.16
+-- main.go --
+package main
+
+func _() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		if got := env.Editor.DiagnosticsVersion("main.go"); got != 0 {
+			t.Errorf("DiagnosticsVersion before opening = %d, want 0", got)
+		}
+		env.OpenFile("main.go")
+		env.RegexpReplace("main.go", "{}", "{ x := 2 }")
+		env.AfterChange(Diagnostics(env.AtRegexp("main.go", "x")))
+		if got, want := env.Editor.DiagnosticsVersion("main.go"), env.Editor.BufferVersion("main.go"); int(got) != want {
+			t.Errorf("DiagnosticsVersion = %d, want buffer version %d", got, want)
+		}
+		env.RegexpReplace("main.go", "x := 2", "_ = 2")
+		env.AfterChange(NoDiagnostics(ForFile("main.go")))
+		if got, want := env.Editor.DiagnosticsVersion("main.go"), env.Editor.BufferVersion("main.go"); int(got) != want {
+			t.Errorf("DiagnosticsVersion after fix = %d, want buffer version %d", got, want)
+		}
+	})
+}
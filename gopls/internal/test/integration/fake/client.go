@@ -104,6 +104,7 @@ func (c *Client) Event(ctx context.Context, event *interface{}) error {
 }
 
 func (c *Client) PublishDiagnostics(ctx context.Context, params *protocol.PublishDiagnosticsParams) error {
+	c.editor.diagnostics.update(params)
 	if c.hooks.OnDiagnostics != nil {
 		return c.hooks.OnDiagnostics(ctx, params)
 	}
@@ -134,11 +135,9 @@ func (c *Client) RegisterCapability(ctx context.Context, params *protocol.Regist
 			return err
 		}
 	}
-	// Update file watching patterns.
-	//
-	// TODO(rfindley): We could verify more here, like verify that the
-	// registration ID is distinct, and that the capability is not currently
-	// registered.
+	// Parse file watching patterns before recording anything, so that an
+	// invalid registration has no effect.
+	globs := make(map[string][]*glob.Glob)
 	for _, registration := range params.Registrations {
 		if registration.Method == "workspace/didChangeWatchedFiles" {
 			// Marshal and unmarshal to interpret RegisterOptions as
@@ -151,7 +150,6 @@ func (c *Client) RegisterCapability(ctx context.Context, params *protocol.Regist
 			if err := json.Unmarshal(raw, &opts); err != nil {
 				return fmt.Errorf("unmarshaling registration options: %v", err)
 			}
-			var globs []*glob.Glob
 			for _, watcher := range opts.Watchers {
 				var globPattern string
 				switch pattern := watcher.GlobPattern.Value.(type) {
@@ -165,28 +163,62 @@ func (c *Client) RegisterCapability(ctx context.Context, params *protocol.Regist
 				if err != nil {
 					return fmt.Errorf("error parsing glob pattern %q: %v", watcher.GlobPattern, err)
 				}
-				globs = append(globs, g)
+				globs[registration.ID] = append(globs[registration.ID], g)
 			}
-			c.editor.mu.Lock()
-			c.editor.watchPatterns = globs
-			c.editor.mu.Unlock()
 		}
 	}
+
+	c.editor.mu.Lock()
+	defer c.editor.mu.Unlock()
+	for _, registration := range params.Registrations {
+		if _, ok := c.editor.registrations[registration.ID]; ok {
+			return fmt.Errorf("duplicate registration ID %q", registration.ID)
+		}
+	}
+	for _, registration := range params.Registrations {
+		c.editor.registrations[registration.ID] = registration
+		if registration.Method == "workspace/didChangeWatchedFiles" {
+			c.editor.watchGlobs[registration.ID] = globs[registration.ID]
+		}
+	}
+	c.editor.updateWatchPatternsLocked()
 	return nil
 }
 
 func (c *Client) UnregisterCapability(ctx context.Context, params *protocol.UnregistrationParams) error {
 	if c.hooks.OnUnregisterCapability != nil {
-		return c.hooks.OnUnregisterCapability(ctx, params)
+		if err := c.hooks.OnUnregisterCapability(ctx, params); err != nil {
+			return err
+		}
 	}
+	c.editor.mu.Lock()
+	defer c.editor.mu.Unlock()
+	for _, unregistration := range params.Unregisterations {
+		reg, ok := c.editor.registrations[unregistration.ID]
+		if !ok || reg.Method != unregistration.Method {
+			return fmt.Errorf("no %s registration with ID %q", unregistration.Method, unregistration.ID)
+		}
+		delete(c.editor.registrations, unregistration.ID)
+		delete(c.editor.watchGlobs, unregistration.ID)
+	}
+	c.editor.updateWatchPatternsLocked()
 	return nil
 }
 
 func (c *Client) Progress(ctx context.Context, params *protocol.ProgressParams) error {
+	handled, err := c.editor.progress.partialResult(params)
+	if err != nil {
+		err = fmt.Errorf("reading partial result: %v", err)
+	}
+	if !handled {
+		c.editor.progress.update(params)
+	}
 	if c.hooks.OnProgress != nil {
-		return c.hooks.OnProgress(ctx, params)
+		if err := c.hooks.OnProgress(ctx, params); err != nil {
+			return err
+		}
 	}
-	return nil
+	return err
 }
 
 func (c *Client) WorkDoneProgressCreate(ctx context.Context, params *protocol.WorkDoneProgressCreateParams) error {
@@ -197,6 +229,9 @@ func (c *Client) WorkDoneProgressCreate(ctx context.Context, params *protocol.Wo
 }
 
 func (c *Client) ShowDocument(ctx context.Context, params *protocol.ShowDocumentParams) (*protocol.ShowDocumentResult, error) {
+	c.editor.callsMu.Lock()
+	c.editor.shown = append(c.editor.shown, *params)
+	c.editor.callsMu.Unlock()
 	if c.hooks.OnShowDocument != nil {
 		if err := c.hooks.OnShowDocument(ctx, params); err != nil {
 			return nil, err
@@ -210,12 +245,20 @@ func (c *Client) ApplyEdit(ctx context.Context, params *protocol.ApplyWorkspaceE
 	if len(params.Edit.Changes) > 0 {
 		return &protocol.ApplyWorkspaceEditResult{FailureReason: "Edit.Changes is unsupported"}, nil
 	}
-	onApplyEdit := c.editor.applyWorkspaceEdit
 	if ptr := c.onApplyEdit.Load(); ptr != nil {
-		onApplyEdit = *ptr
+		if err := (*ptr)(ctx, &params.Edit); err != nil {
+			return nil, err
+		}
+		return &protocol.ApplyWorkspaceEditResult{Applied: true}, nil
 	}
-	if err := onApplyEdit(ctx, &params.Edit); err != nil {
-		return nil, err
+	// Changes are applied in order until one fails, as with the "abort"
+	// failure handling strategy; the failure is reported to the server
+	// rather than returned as an error.
+	if failed, err := c.editor.applyDocumentChanges(ctx, params.Edit.DocumentChanges); err != nil {
+		return &protocol.ApplyWorkspaceEditResult{
+			FailureReason: err.Error(),
+			FailedChange:  uint32(failed),
+		}, nil
 	}
 	return &protocol.ApplyWorkspaceEditResult{Applied: true}, nil
 }
@@ -0,0 +1,114 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+	"golang.org/x/tools/internal/jsonrpc2"
+	"golang.org/x/tools/internal/xcontext"
+)
+
+// An ErrorCode is a JSON-RPC or LSP error code. Error codes may be used as
+// the target of errors.Is, to test whether an error returned by the Editor's
+// Server (or by an Editor method that calls it) is a response with that code:
+//
+//	if errors.Is(err, fake.ContentModified) { ... }
+type ErrorCode int64
+
+// Error codes that are meaningful to the LSP client.
+const (
+	InvalidParams    = ErrorCode(protocol.InvalidParams)
+	MethodNotFound   = ErrorCode(protocol.MethodNotFound)
+	InternalError    = ErrorCode(protocol.InternalError)
+	RequestCancelled = ErrorCode(protocol.RequestCancelled)
+	ContentModified  = ErrorCode(protocol.ContentModified)
+	ServerCancelled  = ErrorCode(protocol.ServerCancelled)
+	RequestFailed    = ErrorCode(protocol.RequestFailed)
+)
+
+func (c ErrorCode) Error() string {
+	return fmt.Sprintf("error code %d", int64(c))
+}
+
+// A ResponseError is an error response from the server to a request.
+//
+// Its Error method returns just the server's message, so that existing
+// assertions on error text are unaffected.
+type ResponseError struct {
+	Method  string          // LSP method of the request
+	Code    ErrorCode       // error code of the response
+	Message string          // error message of the response
+	Data    json.RawMessage // optional error data, or nil
+}
+
+func (e *ResponseError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is the error code of e.
+func (e *ResponseError) Is(target error) bool {
+	return target == e.Code
+}
+
+// callConn is the editor's connection to the server. It converts error
+// responses to calls into ResponseErrors, and, if timeout is positive, fails
+// calls that receive no response within the timeout. If record is non-nil, it
+// is called with the round-trip time of each call that receives a response.
+//
+// Calls whose context is cancelled by the caller are cancelled on the server
+// by the protocol.ServerDispatcher wrapping the connection, which sends
+// $/cancelRequest with the ID of the abandoned call.
+type callConn struct {
+	jsonrpc2.Conn
+	timeout time.Duration
+	record  func(method string, d time.Duration)
+}
+
+func (c callConn) Call(ctx context.Context, method string, params, result interface{}) (jsonrpc2.ID, error) {
+	callCtx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	id, err := c.Conn.Call(callCtx, method, params, result)
+	var wireErr *jsonrpc2.WireError
+	switch {
+	case err == nil:
+		c.recordDuration(method, start)
+	case errors.As(err, &wireErr):
+		c.recordDuration(method, start)
+		respErr := &ResponseError{
+			Method:  method,
+			Code:    ErrorCode(wireErr.Code),
+			Message: wireErr.Message,
+		}
+		if wireErr.Data != nil {
+			respErr.Data = *wireErr.Data
+		}
+		err = respErr
+	case ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded:
+		// Cancel the request on the server, as the caller's (unexpired)
+		// context would otherwise not trigger the cancellation. A hung server
+		// may not be reading its input, so don't wait for the notification to
+		// be written.
+		go c.Conn.Notify(xcontext.Detach(ctx), "$/cancelRequest", &protocol.CancelParams{ID: &id})
+		err = fmt.Errorf("%s: no response from server after %v: %w", method, c.timeout, err)
+	}
+	return id, err
+}
+
+func (c callConn) recordDuration(method string, start time.Time) {
+	if c.record != nil {
+		c.record(method, time.Since(start))
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+)
+
+// diagnosticsState tracks the textDocument/publishDiagnostics notifications
+// received by the Client, so that the Editor can await changes to them.
+type diagnosticsState struct {
+	mu      sync.Mutex
+	changed chan struct{}                                               // closed and replaced on each change
+	latest  map[protocol.DocumentURI]*protocol.PublishDiagnosticsParams // most recent publication, by URI
+}
+
+func newDiagnosticsState() *diagnosticsState {
+	return &diagnosticsState{
+		changed: make(chan struct{}),
+		latest:  make(map[protocol.DocumentURI]*protocol.PublishDiagnosticsParams),
+	}
+}
+
+// update records the given diagnostics publication.
+func (d *diagnosticsState) update(params *protocol.PublishDiagnosticsParams) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.latest[params.URI] = params
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// await blocks until cond, which is called with d.mu held, reports true, or
+// ctx is done.
+func (d *diagnosticsState) await(ctx context.Context, cond func() bool) error {
+	for {
+		d.mu.Lock()
+		met, changed := cond(), d.changed
+		d.mu.Unlock()
+		if met {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// AwaitDiagnosticsCleared blocks until the server has published an empty
+// set of diagnostics for the file at the given workdir-relative path, as it
+// does for example when a buffer containing errors is closed and its content
+// reverts to a valid file on disk.
+//
+// It returns immediately if the most recent publication for the file was
+// already empty.
+func (e *Editor) AwaitDiagnosticsCleared(ctx context.Context, path string) error {
+	uri := e.sandbox.Workdir.URI(path)
+	return e.diagnostics.await(ctx, func() bool {
+		params, ok := e.diagnostics.latest[uri]
+		return ok && len(params.Diagnostics) == 0
+	})
+}
+
+// AwaitDiagnosticsFor blocks until the server has published diagnostics for
+// each of the files at the given workdir-relative paths, and returns the
+// most recently published diagnostics for each, keyed by path.
+//
+// Publications received before the call count: it returns immediately if
+// every file already has diagnostics.
+func (e *Editor) AwaitDiagnosticsFor(ctx context.Context, paths []string) (map[string][]protocol.Diagnostic, error) {
+	var res map[string][]protocol.Diagnostic
+	err := e.diagnostics.await(ctx, func() bool {
+		res = make(map[string][]protocol.Diagnostic)
+		for _, path := range paths {
+			params, ok := e.diagnostics.latest[e.sandbox.Workdir.URI(path)]
+			if !ok {
+				return false
+			}
+			res[path] = params.Diagnostics
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// PublishedDiagnostics returns the diagnostics most recently published by
+// the server for the file at the given workdir-relative path. The second
+// result reports whether any diagnostics have been published for the file.
+func (e *Editor) PublishedDiagnostics(path string) ([]protocol.Diagnostic, bool) {
+	e.diagnostics.mu.Lock()
+	defer e.diagnostics.mu.Unlock()
+	params, ok := e.diagnostics.latest[e.sandbox.Workdir.URI(path)]
+	if !ok {
+		return nil, false
+	}
+	return params.Diagnostics, true
+}
+
+// AwaitPublishedDiagnostics blocks until the server has published
+// diagnostics for the file at the given workdir-relative path computed for
+// at least the given buffer version, and returns them.
+//
+// It returns immediately if such diagnostics were already published.
+func (e *Editor) AwaitPublishedDiagnostics(ctx context.Context, path string, version int) ([]protocol.Diagnostic, error) {
+	uri := e.sandbox.Workdir.URI(path)
+	var diags []protocol.Diagnostic
+	err := e.diagnostics.await(ctx, func() bool {
+		params, ok := e.diagnostics.latest[uri]
+		if !ok || int(params.Version) < version {
+			return false
+		}
+		diags = params.Diagnostics
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diags, nil
+}
+
+// DiagnosticsVersion returns the document version of the diagnostics most
+// recently published by the server for the file at the given
+// workdir-relative path, or 0 if none have been published or the server did
+// not report a version.
+func (e *Editor) DiagnosticsVersion(path string) int32 {
+	e.diagnostics.mu.Lock()
+	defer e.diagnostics.mu.Unlock()
+	if params, ok := e.diagnostics.latest[e.sandbox.Workdir.URI(path)]; ok {
+		return params.Version
+	}
+	return 0
+}
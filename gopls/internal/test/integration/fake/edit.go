@@ -5,6 +5,9 @@
 package fake
 
 import (
+	"fmt"
+	"sort"
+
 	"golang.org/x/tools/gopls/internal/protocol"
 	"golang.org/x/tools/internal/diff"
 )
@@ -40,3 +43,20 @@ func applyEdits(mapper *protocol.Mapper, edits []protocol.TextEdit, windowsLineE
 	}
 	return patched, nil
 }
+
+// sortEdits returns a copy of edits sorted by range, preserving the relative
+// order of insertions at the same position. It reports an error if any two
+// edits overlap, as the result of applying them would be ambiguous.
+func sortEdits(edits []protocol.TextEdit) ([]protocol.TextEdit, error) {
+	sorted := append([]protocol.TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return protocol.CompareRange(sorted[i].Range, sorted[j].Range) < 0
+	})
+	for i := 1; i < len(sorted); i++ {
+		prev, edit := sorted[i-1].Range, sorted[i].Range
+		if protocol.ComparePosition(edit.Start, prev.End) < 0 {
+			return nil, fmt.Errorf("overlapping edits at %v and %v", prev, edit)
+		}
+	}
+	return sorted, nil
+}
@@ -7,6 +7,7 @@ package fake
 import (
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/tools/gopls/internal/protocol"
 )
 
@@ -94,3 +95,70 @@ func TestApplyEdits(t *testing.T) {
 		})
 	}
 }
+
+func TestSortEdits(t *testing.T) {
+	tests := []struct {
+		label   string
+		edits   []protocol.TextEdit
+		want    []protocol.TextEdit
+		wantErr bool
+	}{
+		{
+			label: "out of order",
+			edits: []protocol.TextEdit{
+				NewEdit(3, 1, 3, 2, "main"),
+				NewEdit(1, 0, 1, 0, "import"),
+			},
+			want: []protocol.TextEdit{
+				NewEdit(1, 0, 1, 0, "import"),
+				NewEdit(3, 1, 3, 2, "main"),
+			},
+		},
+		{
+			label: "insertions at the same position",
+			edits: []protocol.TextEdit{
+				NewEdit(1, 0, 1, 0, "a"),
+				NewEdit(1, 0, 1, 0, "b"),
+			},
+			want: []protocol.TextEdit{
+				NewEdit(1, 0, 1, 0, "a"),
+				NewEdit(1, 0, 1, 0, "b"),
+			},
+		},
+		{
+			label: "adjacent",
+			edits: []protocol.TextEdit{
+				NewEdit(0, 2, 0, 4, "b"),
+				NewEdit(0, 0, 0, 2, "a"),
+			},
+			want: []protocol.TextEdit{
+				NewEdit(0, 0, 0, 2, "a"),
+				NewEdit(0, 2, 0, 4, "b"),
+			},
+		},
+		{
+			label: "overlapping",
+			edits: []protocol.TextEdit{
+				NewEdit(0, 2, 0, 4, "main"),
+				NewEdit(0, 0, 0, 3, "additional"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.label, func(t *testing.T) {
+			got, err := sortEdits(test.edits)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got err %v, want error: %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("sortEdits: unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -10,19 +10,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/tools/gopls/internal/protocol"
 	"golang.org/x/tools/gopls/internal/protocol/command"
+	"golang.org/x/tools/gopls/internal/settings"
 	"golang.org/x/tools/gopls/internal/test/integration/fake/glob"
 	"golang.org/x/tools/gopls/internal/util/bug"
 	"golang.org/x/tools/gopls/internal/util/pathutil"
 	"golang.org/x/tools/gopls/internal/util/slices"
+	"golang.org/x/tools/gopls/internal/vulncheck"
 	"golang.org/x/tools/internal/jsonrpc2"
 	"golang.org/x/tools/internal/jsonrpc2/servertest"
 	"golang.org/x/tools/internal/xcontext"
@@ -40,34 +47,72 @@ type Editor struct {
 	client     *Client
 	sandbox    *Sandbox
 
+	// saveMu serializes SaveBuffer and EditAndSave, so that the actions
+	// performed before a save do not interleave with those of another.
+	saveMu sync.Mutex
+
 	// TODO(rfindley): buffers should be keyed by protocol.DocumentURI.
 	mu                       sync.Mutex
 	config                   EditorConfig                // editor configuration
 	buffers                  map[string]buffer           // open buffers (relative path -> buffer content)
 	serverCapabilities       protocol.ServerCapabilities // capabilities / options
 	semTokOpts               protocol.SemanticTokensOptions
-	watchPatterns            []*glob.Glob // glob patterns to watch
+	registrations            map[string]protocol.Registration // active dynamic capability registrations, by ID
+	watchGlobs               map[string][]*glob.Glob          // file watching patterns, by registration ID
+	watchPatterns            []*glob.Glob                     // glob patterns to watch: the union of watchGlobs
 	suggestionUseReplaceMode bool
+	compilerOptDetails       map[string]bool // directories whose compiler optimization details are toggled on
 
 	// Call metrics for the purpose of expectations. This is done in an ad-hoc
 	// manner for now. Perhaps in the future we should do something more
 	// systematic. Guarded with a separate mutex as calls may need to be accessed
 	// asynchronously via callbacks into the Editor.
-	callsMu sync.Mutex
-	calls   CallCounts
+	callsMu   sync.Mutex
+	calls     CallCounts
+	unhandled []string                      // methods of server-to-client RPCs that were not handled
+	shown     []protocol.ShowDocumentParams // showDocument requests, in order of receipt
+	durations map[string][]time.Duration    // round-trip times of answered requests, by method
+
+	// annotations holds the change annotations of the annotated text edits
+	// applied by the editor, in order.
+	annotations []protocol.ChangeAnnotationIdentifier
+
+	// lastConfigChange holds the most recent didChangeConfiguration
+	// notification sent to the server, or nil if none has been sent.
+	lastConfigChange *protocol.DidChangeConfigurationParams
+
+	// watchPending counts the didChangeWatchedFiles notifications that have
+	// been counted in calls but not yet sent; watchIdle is closed whenever it
+	// drops to zero. Both are guarded by callsMu.
+	watchPending int
+	watchIdle    chan struct{}
+
+	// progress tracks $/progress notifications from the server.
+	progress *progressState
+
+	// diagnostics tracks textDocument/publishDiagnostics notifications from
+	// the server.
+	diagnostics *diagnosticsState
 }
 
 // CallCounts tracks the number of protocol notifications of different types.
 type CallCounts struct {
 	DidOpen, DidChange, DidSave, DidChangeWatchedFiles, DidClose, DidChangeConfiguration uint64
+	WillSave, DidChangeWorkspaceFolders                                                  uint64
+	DidCreateFiles, DidRenameFiles, DidDeleteFiles                                       uint64
 }
 
 // buffer holds information about an open buffer in the editor.
 type buffer struct {
-	version int              // monotonic version; incremented on edits
-	path    string           // relative path in the workspace
-	mapper  *protocol.Mapper // buffer content
-	dirty   bool             // if true, content is unsaved (TODO(rfindley): rename this field)
+	version  int              // monotonic version; incremented on edits
+	path     string           // relative path in the workspace
+	mapper   *protocol.Mapper // buffer content
+	dirty    bool             // if true, content is unsaved (TODO(rfindley): rename this field)
+	readOnly string           // if non-empty, the reason the buffer may not be edited
+
+	// lastChanges holds the content changes of the most recent didChange
+	// notification for this buffer.
+	lastChanges []protocol.TextDocumentContentChangeEvent
 }
 
 func (b buffer) text() string {
@@ -131,6 +176,46 @@ type EditorConfig struct {
 	// client capabilities struct, before sending to the server.
 	CapabilitiesJSON []byte
 
+	// NoWorkspaceConfiguration disables the workspace/configuration client
+	// capability, simulating an editor that does not support pulling
+	// configuration. The server must then rely on the settings sent in
+	// initializationOptions.
+	//
+	// Since capabilities are negotiated during initialization, changing this
+	// field via Editor.ChangeConfiguration has no effect.
+	NoWorkspaceConfiguration bool
+
+	// RequestTimeout, if positive, bounds the time the editor waits for the
+	// response to each request it sends to the server. A request that times
+	// out is cancelled, and fails with an error naming its LSP method, so
+	// that a hung server is diagnosed promptly rather than by the test's
+	// overall timeout.
+	//
+	// Since the connection is established once, changing this field via
+	// Editor.ChangeConfiguration has no effect.
+	RequestTimeout time.Duration
+
+	// ResolveCompletionBeforeAccept causes AcceptCompletion to resolve
+	// completion items that carry data for the server (via
+	// completionItem/resolve) before applying them, so that additional edits
+	// computed lazily by the server, such as import insertions, are applied.
+	ResolveCompletionBeforeAccept bool
+
+	// CompletionItemDefaults advertises support for the editRange default of
+	// completion lists, allowing the server to omit the textEdit of items
+	// that share the list's edit range. Completion fills in the textEdit of
+	// such items, so that they may be accepted like any other.
+	//
+	// Since capabilities are negotiated during initialization, changing this
+	// field via Editor.ChangeConfiguration has no effect.
+	CompletionItemDefaults bool
+
+	// PushConfiguration causes ChangeConfiguration to include the full
+	// settings in its didChangeConfiguration notification, as done by
+	// clients that push configuration rather than waiting for the server to
+	// pull it with workspace/configuration.
+	PushConfiguration bool
+
 	// If non-nil, MessageResponder is used to respond to ShowMessageRequest
 	// messages.
 	MessageResponder func(params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error)
@@ -139,9 +224,66 @@ type EditorConfig struct {
 // NewEditor creates a new Editor.
 func NewEditor(sandbox *Sandbox, config EditorConfig) *Editor {
 	return &Editor{
-		buffers: make(map[string]buffer),
-		sandbox: sandbox,
-		config:  config,
+		buffers:       make(map[string]buffer),
+		sandbox:       sandbox,
+		config:        config,
+		registrations: make(map[string]protocol.Registration),
+		watchGlobs:    make(map[string][]*glob.Glob),
+		progress:      newProgressState(),
+		diagnostics:   newDiagnosticsState(),
+	}
+}
+
+// recordDuration records the round-trip time of an answered request.
+func (e *Editor) recordDuration(method string, d time.Duration) {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	if e.durations == nil {
+		e.durations = make(map[string][]time.Duration)
+	}
+	e.durations[method] = append(e.durations[method], d)
+}
+
+// RequestDurations returns the round-trip times of the requests to the
+// server that have received a response, successful or not, keyed by method
+// and in order of completion.
+func (e *Editor) RequestDurations() map[string][]time.Duration {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	res := make(map[string][]time.Duration, len(e.durations))
+	for method, ds := range e.durations {
+		res[method] = slices.Clone(ds)
+	}
+	return res
+}
+
+// IsRegistered reports whether the server has dynamically registered a
+// capability for the given method (such as
+// "workspace/didChangeWatchedFiles"), and not since unregistered it.
+func (e *Editor) IsRegistered(method string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, reg := range e.registrations {
+		if reg.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// updateWatchPatternsLocked recomputes the file watching patterns from the
+// active registrations.
+//
+// Precondition: e.mu must be held.
+func (e *Editor) updateWatchPatternsLocked() {
+	ids := make([]string, 0, len(e.watchGlobs))
+	for id := range e.watchGlobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids) // for determinism
+	e.watchPatterns = nil
+	for _, id := range ids {
+		e.watchPatterns = append(e.watchPatterns, e.watchGlobs[id]...)
 	}
 }
 
@@ -158,14 +300,18 @@ func (e *Editor) Connect(ctx context.Context, connector servertest.Connector, ho
 	e.cancelConn = cancelConn
 
 	e.serverConn = conn
-	e.Server = protocol.ServerDispatcher(conn)
+	e.Server = protocol.ServerDispatcher(callConn{conn, e.config.RequestTimeout, e.recordDuration})
 	e.client = &Client{editor: e, hooks: hooks}
 	conn.Go(bgCtx,
 		protocol.Handlers(
 			protocol.ClientHandler(e.client,
-				jsonrpc2.MethodNotFound)))
+				e.methodNotFound)))
 
 	if err := e.initialize(ctx); err != nil {
+		// Don't leak the connection if initialization failed, for example
+		// because ctx was done before the server responded.
+		cancelConn()
+		conn.Close()
 		return nil, err
 	}
 	e.sandbox.Workdir.AddWatcher(e.onFileChanges)
@@ -178,6 +324,26 @@ func (e *Editor) Stats() CallCounts {
 	return e.calls
 }
 
+// methodNotFound is the fallback handler for server-to-client RPCs that the
+// Client does not implement. It records the method before replying with the
+// standard method not found error.
+func (e *Editor) methodNotFound(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	e.callsMu.Lock()
+	e.unhandled = append(e.unhandled, req.Method())
+	e.callsMu.Unlock()
+	return jsonrpc2.MethodNotFound(ctx, reply, req)
+}
+
+// UnhandledServerRequests returns the methods of server-to-client requests
+// and notifications that the editor did not handle, in the order they were
+// received. A non-empty result indicates that the server attempted to use a
+// client method that is not (yet) implemented by the fake Client.
+func (e *Editor) UnhandledServerRequests() []string {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	return slices.Clone(e.unhandled)
+}
+
 // Shutdown issues the 'shutdown' LSP notification.
 func (e *Editor) Shutdown(ctx context.Context) error {
 	if e.Server != nil {
@@ -335,11 +501,16 @@ func (e *Editor) initialize(ctx context.Context) error {
 func clientCapabilities(cfg EditorConfig) (protocol.ClientCapabilities, error) {
 	var capabilities protocol.ClientCapabilities
 	// Set various client capabilities that are sought by gopls.
-	capabilities.Workspace.Configuration = true // support workspace/configuration
+	capabilities.Workspace.Configuration = !cfg.NoWorkspaceConfiguration // support workspace/configuration
 	capabilities.TextDocument.Completion.CompletionItem.TagSupport = &protocol.CompletionItemTagOptions{}
 	capabilities.TextDocument.Completion.CompletionItem.TagSupport.ValueSet = []protocol.CompletionItemTag{protocol.ComplDeprecated}
 	capabilities.TextDocument.Completion.CompletionItem.SnippetSupport = true
 	capabilities.TextDocument.Completion.CompletionItem.InsertReplaceSupport = true
+	if cfg.CompletionItemDefaults {
+		capabilities.TextDocument.Completion.CompletionList = &protocol.CompletionListCapabilities{
+			ItemDefaults: []string{"editRange"},
+		}
+	}
 	capabilities.TextDocument.SemanticTokens.Requests.Full = &protocol.Or_ClientSemanticTokensRequestOptions_full{Value: true}
 	capabilities.Window.WorkDoneProgress = true // support window/workDoneProgress
 	capabilities.TextDocument.SemanticTokens.TokenTypes = []string{
@@ -359,12 +530,20 @@ func clientCapabilities(cfg EditorConfig) (protocol.ClientCapabilities, error) {
 	capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport = true
 	// Glob pattern watching is enabled.
 	capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration = true
-	// "rename" operations are used for package renaming.
-	//
-	// TODO(rfindley): add support for other resource operations (create, delete, ...)
+	// The editor notifies the server of the files it creates, renames and
+	// deletes.
+	capabilities.Workspace.FileOperations = &protocol.FileOperationClientCapabilities{
+		DidCreate: true,
+		DidRename: true,
+		DidDelete: true,
+	}
+	// "rename" operations are used for package renaming, and "create"
+	// operations for extracting declarations to a new file.
 	capabilities.Workspace.WorkspaceEdit = &protocol.WorkspaceEditClientCapabilities{
 		ResourceOperations: []protocol.ResourceOperationKind{
+			"create",
 			"rename",
+			"delete",
 		},
 	}
 
@@ -405,8 +584,11 @@ var uriRE = regexp.MustCompile(`^[a-z][a-z0-9+\-.]*://\S+`)
 
 // makeWorkspaceFolders creates a slice of workspace folders to use for
 // this editing session, based on the editor configuration.
+//
+// As documented for EditorConfig.WorkspaceFolders, nil paths means the
+// workdir root, and an empty non-nil slice means no folders at all.
 func makeWorkspaceFolders(sandbox *Sandbox, paths []string) (folders []protocol.WorkspaceFolder) {
-	if len(paths) == 0 {
+	if paths == nil {
 		paths = []string{string(sandbox.Workdir.RelativeTo)}
 	}
 
@@ -436,10 +618,22 @@ func (e *Editor) onFileChanges(ctx context.Context, evts []protocol.FileEvent) {
 	// the number of expected DidChangeWatchedFiles calls.
 	e.callsMu.Lock()
 	e.calls.DidChangeWatchedFiles++
+	if e.watchPending == 0 {
+		e.watchIdle = make(chan struct{})
+	}
+	e.watchPending++
 	e.callsMu.Unlock()
 
 	// Since e may be locked, we must run this mutation asynchronously.
 	go func() {
+		defer func() {
+			e.callsMu.Lock()
+			e.watchPending--
+			if e.watchPending == 0 {
+				close(e.watchIdle)
+			}
+			e.callsMu.Unlock()
+		}()
 		e.mu.Lock()
 		defer e.mu.Unlock()
 		for _, evt := range evts {
@@ -482,6 +676,30 @@ func (e *Editor) onFileChanges(ctx context.Context, evts []protocol.FileEvent) {
 	}()
 }
 
+// AwaitWatchedFilesDelivered blocks until every didChangeWatchedFiles
+// notification counted so far in Stats().DidChangeWatchedFiles has been sent
+// to the server.
+//
+// The count is incremented synchronously with each file change in the
+// workdir, but the notification itself is sent asynchronously, so without
+// this barrier the count may run ahead of what the server has received.
+func (e *Editor) AwaitWatchedFilesDelivered(ctx context.Context) error {
+	e.callsMu.Lock()
+	pending, idle := e.watchPending, e.watchIdle
+	e.callsMu.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	// If further changes occur before all pending notifications are sent,
+	// this also waits for those.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+		return nil
+	}
+}
+
 // OpenFile creates a buffer for the given workdir-relative file.
 //
 // If the file is already open, it is a no-op.
@@ -489,6 +707,25 @@ func (e *Editor) OpenFile(ctx context.Context, path string) error {
 	if e.HasBuffer(path) {
 		return nil
 	}
+	return e.openFile(ctx, path, false)
+}
+
+// OpenFileReadOnly is like OpenFile, but the resulting buffer rejects all
+// subsequent edits with an error wrapping ErrReadOnly, whether they are made
+// by the test or requested by the server, so that tests can guarantee that
+// the buffer is never dirtied. Changes to the file on disk are still applied.
+//
+// Unlike OpenFile, it is an error if the buffer is already open, as it may
+// already have been edited.
+func (e *Editor) OpenFileReadOnly(ctx context.Context, path string) error {
+	if e.HasBuffer(path) {
+		return fmt.Errorf("buffer %q already exists", path)
+	}
+	return e.openFile(ctx, path, true)
+}
+
+// openFile opens a buffer with the content of the file at path on disk.
+func (e *Editor) openFile(ctx context.Context, path string, readOnly bool) error {
 	content, err := e.sandbox.Workdir.ReadFile(path)
 	if err != nil {
 		return err
@@ -496,7 +733,26 @@ func (e *Editor) OpenFile(ctx context.Context, path string) error {
 	if e.Config().WindowsLineEndings {
 		content = toWindowsLineEndings(content)
 	}
-	return e.createBuffer(ctx, path, false, content)
+	return e.createBuffer(ctx, path, false, readOnly, content)
+}
+
+// OpenFileRaw writes content verbatim to the file at the given
+// workdir-relative path, and opens it in an editor buffer. Unlike OpenFile,
+// it does not normalize line endings, so tests may open files with exactly
+// the given bytes, such as a byte order mark or mixed line endings.
+//
+// The buffer content, and so the content sent to the server in didOpen, is
+// exactly the given content. In particular, a leading UTF-8 byte order mark
+// is not stripped, as some editors do, but is the first character of the
+// buffer.
+func (e *Editor) OpenFileRaw(ctx context.Context, path, content string) error {
+	if e.HasBuffer(path) {
+		return fmt.Errorf("buffer %q already exists", path)
+	}
+	if err := e.sandbox.Workdir.WriteFile(ctx, path, content); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	return e.createBuffer(ctx, path, false, false, []byte(content))
 }
 
 // toWindowsLineEndings checks whether content has windows line endings.
@@ -526,10 +782,10 @@ func toWindowsLineEndings(content []byte) []byte {
 // CreateBuffer creates a new unsaved buffer corresponding to the workdir path,
 // containing the given textual content.
 func (e *Editor) CreateBuffer(ctx context.Context, path, content string) error {
-	return e.createBuffer(ctx, path, true, []byte(content))
+	return e.createBuffer(ctx, path, true, false, []byte(content))
 }
 
-func (e *Editor) createBuffer(ctx context.Context, path string, dirty bool, content []byte) error {
+func (e *Editor) createBuffer(ctx context.Context, path string, dirty, readOnly bool, content []byte) error {
 	e.mu.Lock()
 
 	if _, ok := e.buffers[path]; ok {
@@ -538,11 +794,20 @@ func (e *Editor) createBuffer(ctx context.Context, path string, dirty bool, cont
 	}
 
 	uri := e.sandbox.Workdir.URI(path)
+	_, inWorkspace := relPath(string(e.sandbox.Workdir.RelativeTo), uri.Path())
+	var readOnlyReason string
+	switch {
+	case !inWorkspace:
+		readOnlyReason = "it is outside the workspace root"
+	case readOnly:
+		readOnlyReason = "it was opened read-only"
+	}
 	buf := buffer{
-		version: 1,
-		path:    path,
-		mapper:  protocol.NewMapper(uri, content),
-		dirty:   dirty,
+		version:  1,
+		path:     path,
+		mapper:   protocol.NewMapper(uri, content),
+		dirty:    dirty,
+		readOnly: readOnlyReason,
 	}
 	e.buffers[path] = buf
 
@@ -564,6 +829,24 @@ func (e *Editor) textDocumentItem(buf buffer) protocol.TextDocumentItem {
 	}
 }
 
+// ForceDidOpen sends a textDocument/didOpen notification for the already
+// open buffer at path, with its current content and version.
+//
+// A duplicate didOpen violates the LSP spec; ForceDidOpen exists to test
+// that the server tolerates it.
+func (e *Editor) ForceDidOpen(ctx context.Context, path string) error {
+	e.mu.Lock()
+	buf, ok := e.buffers[path]
+	if !ok {
+		e.mu.Unlock()
+		return ErrUnknownBuffer
+	}
+	item := e.textDocumentItem(buf)
+	e.mu.Unlock()
+
+	return e.sendDidOpen(ctx, item)
+}
+
 func (e *Editor) sendDidOpen(ctx context.Context, item protocol.TextDocumentItem) error {
 	if e.Server != nil {
 		if err := e.Server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
@@ -619,6 +902,16 @@ func (e *Editor) CloseBuffer(ctx context.Context, path string) error {
 	return e.sendDidClose(ctx, e.TextDocumentIdentifier(path))
 }
 
+// ForceDidClose sends a textDocument/didClose notification for path,
+// regardless of whether the editor has a buffer for it. Any such buffer is
+// left open.
+//
+// A didClose for a document that is not open violates the LSP spec;
+// ForceDidClose exists to test that the server tolerates it.
+func (e *Editor) ForceDidClose(ctx context.Context, path string) error {
+	return e.sendDidClose(ctx, e.TextDocumentIdentifier(path))
+}
+
 func (e *Editor) sendDidClose(ctx context.Context, doc protocol.TextDocumentIdentifier) error {
 	if e.Server != nil {
 		if err := e.Server.DidClose(ctx, &protocol.DidCloseTextDocumentParams{
@@ -642,38 +935,125 @@ func (e *Editor) TextDocumentIdentifier(path string) protocol.TextDocumentIdenti
 // SaveBuffer writes the content of the buffer specified by the given path to
 // the filesystem.
 func (e *Editor) SaveBuffer(ctx context.Context, path string) error {
-	if err := e.OrganizeImports(ctx, path); err != nil {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	if _, err := e.organizeImports(ctx, path, -1); err != nil {
 		return fmt.Errorf("organizing imports before save: %w", err)
 	}
-	if err := e.FormatBuffer(ctx, path); err != nil {
+	if _, err := e.formatBuffer(ctx, path, -1); err != nil {
 		return fmt.Errorf("formatting before save: %w", err)
 	}
 	return e.SaveBufferWithoutActions(ctx, path)
 }
 
+// EditAndSave applies edits to the buffer at path and saves it, organizing
+// imports and formatting it first as SaveBuffer does.
+//
+// Unlike EditBuffer followed by SaveBuffer, the sequence is serialized with
+// other saves, and each step checks that it applies to the buffer version
+// produced by the previous one. If the buffer is modified by anything else
+// between the edit and the save, such as a concurrent edit or a change from
+// disk, EditAndSave fails with an error wrapping ErrVersionChanged, rather
+// than saving content that the caller did not intend.
+func (e *Editor) EditAndSave(ctx context.Context, path string, edits []protocol.TextEdit) error {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+
+	e.mu.Lock()
+	err := e.editBufferLocked(ctx, path, edits)
+	version := e.buffers[path].version
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if version, err = e.organizeImports(ctx, path, version); err != nil {
+		return fmt.Errorf("organizing imports before save: %w", err)
+	}
+	if version, err = e.formatBuffer(ctx, path, version); err != nil {
+		return fmt.Errorf("formatting before save: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.checkVersionLocked(path, version); err != nil {
+		return err
+	}
+	return e.saveBufferLocked(ctx, path)
+}
+
+// editBufferAtVersion applies edits to the buffer at path, failing with an
+// error wrapping ErrVersionChanged if it is not at the given version.
+func (e *Editor) editBufferAtVersion(ctx context.Context, path string, version int, edits []protocol.TextEdit) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if got := e.buffers[path].version; got != version {
+		return fmt.Errorf("buffer %q changed from version %d to %d: %w", path, version, got, ErrVersionChanged)
+	}
+	return e.editBufferLocked(ctx, path, edits)
+}
+
+// checkVersionLocked returns an error wrapping ErrVersionChanged if the
+// buffer at path is not at the given version.
+//
+// Precondition: e.mu must be held.
+func (e *Editor) checkVersionLocked(path string, version int) error {
+	buf, ok := e.buffers[path]
+	if !ok {
+		return fmt.Errorf("unknown buffer %q", path)
+	}
+	if buf.version != version {
+		return fmt.Errorf("buffer %q changed from version %d to %d: %w", path, version, buf.version, ErrVersionChanged)
+	}
+	return nil
+}
+
 func (e *Editor) SaveBufferWithoutActions(ctx context.Context, path string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	return e.saveBufferLocked(ctx, path)
+}
+
+// saveBufferLocked writes the buffer at path to disk, notifying the server
+// with willSave and didSave.
+//
+// Precondition: e.mu must be held.
+func (e *Editor) saveBufferLocked(ctx context.Context, path string) error {
 	buf, ok := e.buffers[path]
 	if !ok {
 		return fmt.Errorf(fmt.Sprintf("unknown buffer: %q", path))
 	}
-	content := buf.text()
-	includeText := false
-	syncOptions, ok := e.serverCapabilities.TextDocumentSync.(protocol.TextDocumentSyncOptions)
-	if ok {
-		includeText = syncOptions.Save.IncludeText
-	}
+	// TextDocumentSync may hold a TextDocumentSyncKind, TextDocumentSyncOptions,
+	// or its JSON decoding, so normalize it via JSON.
+	syncOptions, _ := marshalUnmarshal[protocol.TextDocumentSyncOptions](e.serverCapabilities.TextDocumentSync)
+	includeText := syncOptions.Save != nil && syncOptions.Save.IncludeText
 
 	docID := e.TextDocumentIdentifier(buf.path)
 	if e.Server != nil {
-		if err := e.Server.WillSave(ctx, &protocol.WillSaveTextDocumentParams{
+		params := &protocol.WillSaveTextDocumentParams{
 			TextDocument: docID,
 			Reason:       protocol.Manual,
-		}); err != nil {
+		}
+		if err := e.Server.WillSave(ctx, params); err != nil {
 			return fmt.Errorf("WillSave: %w", err)
 		}
+		e.callsMu.Lock()
+		e.calls.WillSave++
+		e.callsMu.Unlock()
+		if syncOptions.WillSaveWaitUntil {
+			edits, err := e.Server.WillSaveWaitUntil(ctx, params)
+			if err != nil {
+				return fmt.Errorf("WillSaveWaitUntil: %w", err)
+			}
+			if len(edits) > 0 {
+				if err := e.editBufferLocked(ctx, path, edits); err != nil {
+					return fmt.Errorf("applying WillSaveWaitUntil edits: %w", err)
+				}
+				buf = e.buffers[path]
+			}
+		}
 	}
+	content := buf.text()
 	if err := e.sandbox.Workdir.WriteFile(ctx, path, content); err != nil {
 		return fmt.Errorf("writing %q: %w", path, err)
 	}
@@ -704,6 +1084,15 @@ var (
 	ErrUnknownBuffer = errors.New("unknown buffer")
 )
 
+// ErrReadOnly is returned if an edit is attempted on a read-only buffer,
+// such as one opened from the module cache or GOROOT, or with
+// OpenFileReadOnly.
+var ErrReadOnly = errors.New("read-only buffer")
+
+// ErrVersionChanged is returned if a buffer was edited while a request whose
+// result depends on its content was in flight, so that the result is stale.
+var ErrVersionChanged = errors.New("buffer version changed")
+
 // regexpLocation returns the location of the first occurrence of either re
 // or its singular subgroup. It returns ErrNoMatch if the regexp doesn't match.
 func regexpLocation(mapper *protocol.Mapper, re string) (protocol.Location, error) {
@@ -729,6 +1118,38 @@ func regexpLocation(mapper *protocol.Mapper, re string) (protocol.Location, erro
 	return mapper.OffsetLocation(start, end)
 }
 
+// regexpLocations is like regexpLocation, but returns the locations of all
+// non-overlapping occurrences, in order. Matches in which the subgroup does
+// not participate are skipped.
+func regexpLocations(mapper *protocol.Mapper, re string) ([]protocol.Location, error) {
+	rec, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	if n := rec.NumSubexp(); n > 1 {
+		return nil, fmt.Errorf("invalid search regexp %q: expect either 0 or 1 subgroups, got %d", re, n)
+	}
+	var locs []protocol.Location
+	for _, indexes := range rec.FindAllSubmatchIndex(mapper.Content, -1) {
+		start, end := indexes[0], indexes[1]
+		if len(indexes) == 4 {
+			start, end = indexes[2], indexes[3]
+			if start < 0 {
+				continue
+			}
+		}
+		loc, err := mapper.OffsetLocation(start, end)
+		if err != nil {
+			return nil, err
+		}
+		locs = append(locs, loc)
+	}
+	if len(locs) == 0 {
+		return nil, ErrNoMatch
+	}
+	return locs, nil
+}
+
 // RegexpSearch returns the Location of the first match for re in the buffer
 // bufName. For convenience, RegexpSearch supports the following two modes:
 //  1. If re has no subgroups, return the position of the match for re itself.
@@ -773,6 +1194,32 @@ func (e *Editor) RegexpReplace(ctx context.Context, path, re, replace string) er
 	return e.setBufferContentLocked(ctx, path, true, patched, edits)
 }
 
+// RegexpReplaceAll is like RegexpReplace, but replaces every non-overlapping
+// instance of re, or its first subgroup, in a single edit of the buffer.
+// It returns ErrNoMatch if re doesn't match the buffer.
+func (e *Editor) RegexpReplaceAll(ctx context.Context, path, re, replace string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf, ok := e.buffers[path]
+	if !ok {
+		return ErrUnknownBuffer
+	}
+	locs, err := regexpLocations(buf.mapper, re)
+	if err != nil {
+		return err
+	}
+	// The matches are in order and do not overlap, so the edits are too.
+	edits := make([]protocol.TextEdit, len(locs))
+	for i, loc := range locs {
+		edits[i] = protocol.TextEdit{Range: loc.Range, NewText: replace}
+	}
+	patched, err := applyEdits(buf.mapper, edits, e.config.WindowsLineEndings)
+	if err != nil {
+		return fmt.Errorf("editing %q: %v", path, err)
+	}
+	return e.setBufferContentLocked(ctx, path, true, patched, edits)
+}
+
 // EditBuffer applies the given test edits to the buffer identified by path.
 func (e *Editor) EditBuffer(ctx context.Context, path string, edits []protocol.TextEdit) error {
 	e.mu.Lock()
@@ -780,6 +1227,42 @@ func (e *Editor) EditBuffer(ctx context.Context, path string, edits []protocol.T
 	return e.editBufferLocked(ctx, path, edits)
 }
 
+// EditBuffers applies edits to several editor buffers at once, keyed by
+// path. All buffers must be open and all edits must apply cleanly before any
+// buffer is modified, so that a failure leaves every buffer unchanged.
+func (e *Editor) EditBuffers(ctx context.Context, edits map[string][]protocol.TextEdit) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	paths := make([]string, 0, len(edits))
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths) // for determinism
+
+	contents := make(map[string][]byte)
+	for _, path := range paths {
+		buf, ok := e.buffers[path]
+		if !ok {
+			return fmt.Errorf("unknown buffer %q", path)
+		}
+		if buf.readOnly != "" {
+			return readOnlyError(buf)
+		}
+		content, err := applyEdits(buf.mapper, edits[path], e.config.WindowsLineEndings)
+		if err != nil {
+			return fmt.Errorf("editing %q: %v; edits:\n%v", path, err, edits[path])
+		}
+		contents[path] = content
+	}
+	for _, path := range paths {
+		if err := e.setBufferContentLocked(ctx, path, true, contents[path], edits[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *Editor) SetBufferContent(ctx context.Context, path, content string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -826,6 +1309,18 @@ func (e *Editor) BufferVersion(name string) int {
 	return e.buffers[name].version
 }
 
+// LastContentChanges returns the content changes sent in the most recent
+// didChange notification for the buffer with the given name, or nil if the
+// buffer is not open or has not been changed.
+//
+// Edits consisting of a single TextEdit are sent incrementally; all other
+// changes are sent as a replacement of the full buffer content.
+func (e *Editor) LastContentChanges(name string) []protocol.TextDocumentContentChangeEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.buffers[name].lastChanges)
+}
+
 func (e *Editor) editBufferLocked(ctx context.Context, path string, edits []protocol.TextEdit) error {
 	buf, ok := e.buffers[path]
 	if !ok {
@@ -838,16 +1333,39 @@ func (e *Editor) editBufferLocked(ctx context.Context, path string, edits []prot
 	return e.setBufferContentLocked(ctx, path, true, content, edits)
 }
 
-func (e *Editor) setBufferContentLocked(ctx context.Context, path string, dirty bool, content []byte, fromEdits []protocol.TextEdit) error {
+// EditBufferIncremental applies edits to an editor buffer, like EditBuffer,
+// but notifies the server with one incremental content change per edit
+// within a single didChange notification, rather than a full replacement.
+//
+// The edits must not overlap. They are sent in reverse order of position, so
+// that the range of each change is valid in the document resulting from the
+// preceding ones.
+func (e *Editor) EditBufferIncremental(ctx context.Context, path string, edits []protocol.TextEdit) error {
+	sorted, err := sortEdits(edits)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	buf, ok := e.buffers[path]
 	if !ok {
 		return fmt.Errorf("unknown buffer %q", path)
 	}
-	buf.mapper = protocol.NewMapper(buf.mapper.URI, content)
-	buf.version++
-	buf.dirty = dirty
-	e.buffers[path] = buf
+	content, err := applyEdits(buf.mapper, edits, e.config.WindowsLineEndings)
+	if err != nil {
+		return fmt.Errorf("editing %q: %v; edits:\n%v", path, err, edits)
+	}
+	changes := make([]protocol.TextDocumentContentChangeEvent, 0, len(sorted))
+	for i := len(sorted) - 1; i >= 0; i-- {
+		changes = append(changes, protocol.TextDocumentContentChangeEvent{
+			Range: &sorted[i].Range,
+			Text:  sorted[i].NewText,
+		})
+	}
+	return e.changeBufferLocked(ctx, path, true, content, changes)
+}
 
+func (e *Editor) setBufferContentLocked(ctx context.Context, path string, dirty bool, content []byte, fromEdits []protocol.TextEdit) error {
 	// A simple heuristic: if there is only one edit, send it incrementally.
 	// Otherwise, send the entire content.
 	var evt protocol.TextDocumentContentChangeEvent
@@ -855,14 +1373,41 @@ func (e *Editor) setBufferContentLocked(ctx context.Context, path string, dirty
 		evt.Range = &fromEdits[0].Range
 		evt.Text = fromEdits[0].NewText
 	} else {
-		evt.Text = buf.text()
+		evt.Text = string(content)
 	}
+	return e.changeBufferLocked(ctx, path, dirty, content, []protocol.TextDocumentContentChangeEvent{evt})
+}
+
+// readOnlyError returns an error wrapping ErrReadOnly for the given
+// read-only buffer.
+func readOnlyError(buf buffer) error {
+	return fmt.Errorf("cannot edit %q: %w (%s)", buf.path, ErrReadOnly, buf.readOnly)
+}
+
+// changeBufferLocked sets the content of the buffer at path, and notifies the
+// server of the given changes, which must transform the previous content
+// into the new content.
+func (e *Editor) changeBufferLocked(ctx context.Context, path string, dirty bool, content []byte, changes []protocol.TextDocumentContentChangeEvent) error {
+	buf, ok := e.buffers[path]
+	if !ok {
+		return fmt.Errorf("unknown buffer %q", path)
+	}
+	// Changes from disk are always applied; only edits are rejected.
+	if dirty && buf.readOnly != "" {
+		return readOnlyError(buf)
+	}
+	buf.mapper = protocol.NewMapper(buf.mapper.URI, content)
+	buf.version++
+	buf.dirty = dirty
+	buf.lastChanges = changes
+	e.buffers[path] = buf
+
 	params := &protocol.DidChangeTextDocumentParams{
 		TextDocument: protocol.VersionedTextDocumentIdentifier{
 			Version:                int32(buf.version),
 			TextDocumentIdentifier: e.TextDocumentIdentifier(buf.path),
 		},
-		ContentChanges: []protocol.TextDocumentContentChangeEvent{evt},
+		ContentChanges: buf.lastChanges,
 	}
 	if e.Server != nil {
 		if err := e.Server.DidChange(ctx, params); err != nil {
@@ -909,6 +1454,43 @@ func (e *Editor) TypeDefinition(ctx context.Context, loc protocol.Location) (pro
 	return e.extractFirstLocation(ctx, resp)
 }
 
+// Declarations returns the declarations of the symbol at the given location
+// in an open buffer, normalizing the server's response (a list of locations
+// or of declaration links) to a list of locations. For links, the location
+// is that of the target's selection range.
+func (e *Editor) Declarations(ctx context.Context, loc protocol.Location) ([]protocol.Location, error) {
+	if err := e.checkBufferLocation(loc); err != nil {
+		return nil, err
+	}
+	params := &protocol.DeclarationParams{}
+	params.TextDocument.URI = loc.URI
+	params.Position = loc.Range.Start
+
+	resp, err := e.Server.Declaration(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("declaration: %w", err)
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	switch v := resp.Value.(type) {
+	case nil:
+		return nil, nil
+	case protocol.Location:
+		return []protocol.Location{v}, nil
+	case []protocol.Location:
+		return v, nil
+	case []protocol.DeclarationLink:
+		locs := make([]protocol.Location, len(v))
+		for i, link := range v {
+			locs[i] = protocol.Location{URI: link.TargetURI, Range: link.TargetSelectionRange}
+		}
+		return locs, nil
+	default:
+		return nil, fmt.Errorf("declaration: unexpected result type %T", v)
+	}
+}
+
 // extractFirstLocation returns the first location.
 // It opens the file if needed.
 func (e *Editor) extractFirstLocation(ctx context.Context, locs []protocol.Location) (protocol.Location, error) {
@@ -925,7 +1507,115 @@ func (e *Editor) extractFirstLocation(ctx context.Context, locs []protocol.Locat
 	return locs[0], nil
 }
 
-// Symbol performs a workspace symbol search using query
+// PrepareCallHierarchy returns the call hierarchy items for the symbol at the
+// given location. Like the locations resulting from Definition, the file
+// containing loc is opened if it is not already open.
+func (e *Editor) PrepareCallHierarchy(ctx context.Context, loc protocol.Location) ([]protocol.CallHierarchyItem, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if path := e.sandbox.Workdir.URIToPath(loc.URI); !e.HasBuffer(path) {
+		if err := e.OpenFile(ctx, path); err != nil {
+			return nil, fmt.Errorf("OpenFile: %w", err)
+		}
+	}
+	if err := e.checkBufferLocation(loc); err != nil {
+		return nil, err
+	}
+	params := &protocol.CallHierarchyPrepareParams{}
+	params.TextDocument.URI = loc.URI
+	params.Position = loc.Range.Start
+
+	items, err := e.Server.PrepareCallHierarchy(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("prepare call hierarchy: %w", err)
+	}
+	return items, nil
+}
+
+// PrepareCallHierarchyBatch is like PrepareCallHierarchy, but prepares the
+// call hierarchy at each of the given locations, issuing the requests
+// concurrently. The resulting map holds the items for each location whose
+// request succeeded.
+//
+// All requests are attempted even if some fail; in that case the returned
+// error reports the number of failures and wraps the first of them, in the
+// order of locs.
+func (e *Editor) PrepareCallHierarchyBatch(ctx context.Context, locs []protocol.Location) (map[protocol.Location][]protocol.CallHierarchyItem, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	// Open files up front, so that concurrent requests don't race to open the
+	// same file.
+	for _, loc := range locs {
+		if path := e.sandbox.Workdir.URIToPath(loc.URI); !e.HasBuffer(path) {
+			if err := e.OpenFile(ctx, path); err != nil {
+				return nil, fmt.Errorf("OpenFile: %w", err)
+			}
+		}
+	}
+
+	var (
+		items = make([][]protocol.CallHierarchyItem, len(locs))
+		errs  = make([]error, len(locs))
+		group errgroup.Group
+	)
+	group.SetLimit(4) // enough to overlap requests without flooding the server
+	for i, loc := range locs {
+		i, loc := i, loc
+		group.Go(func() error {
+			items[i], errs[i] = e.PrepareCallHierarchy(ctx, loc)
+			return nil
+		})
+	}
+	group.Wait()
+
+	result := make(map[protocol.Location][]protocol.CallHierarchyItem)
+	var firstErr error
+	failed := 0
+	for i, loc := range locs {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%v: %w", loc, errs[i])
+			}
+			failed++
+			continue
+		}
+		result[loc] = items[i]
+	}
+	if firstErr != nil {
+		return result, fmt.Errorf("%d of %d call hierarchy requests failed; first: %w", failed, len(locs), firstErr)
+	}
+	return result, nil
+}
+
+// IncomingCalls returns the calls to the given call hierarchy item.
+func (e *Editor) IncomingCalls(ctx context.Context, item protocol.CallHierarchyItem) ([]protocol.CallHierarchyIncomingCall, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	params := &protocol.CallHierarchyIncomingCallsParams{Item: item}
+	calls, err := e.Server.IncomingCalls(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("incoming calls: %w", err)
+	}
+	return calls, nil
+}
+
+// OutgoingCalls returns the calls made by the given call hierarchy item.
+func (e *Editor) OutgoingCalls(ctx context.Context, item protocol.CallHierarchyItem) ([]protocol.CallHierarchyOutgoingCall, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	params := &protocol.CallHierarchyOutgoingCallsParams{Item: item}
+	calls, err := e.Server.OutgoingCalls(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("outgoing calls: %w", err)
+	}
+	return calls, nil
+}
+
+// Symbol performs a workspace symbol search using query
 func (e *Editor) Symbol(ctx context.Context, query string) ([]protocol.SymbolInformation, error) {
 	params := &protocol.WorkspaceSymbolParams{Query: query}
 	return e.Server.Symbol(ctx, params)
@@ -933,11 +1623,57 @@ func (e *Editor) Symbol(ctx context.Context, query string) ([]protocol.SymbolInf
 
 // OrganizeImports requests and performs the source.organizeImports codeAction.
 func (e *Editor) OrganizeImports(ctx context.Context, path string) error {
-	loc := e.sandbox.Workdir.EntireFile(path)
-	_, err := e.applyCodeActions(ctx, loc, nil, protocol.SourceOrganizeImports)
+	_, err := e.organizeImports(ctx, path, -1)
 	return err
 }
 
+// organizeImports performs the source.organizeImports codeAction on the
+// buffer at path, and returns the resulting buffer version.
+//
+// If version is non-negative, the action's edits must have been computed for
+// that version of the buffer, and the buffer must still be at that version
+// when they are applied; otherwise an error wrapping ErrVersionChanged is
+// returned.
+func (e *Editor) organizeImports(ctx context.Context, path string, version int) (int, error) {
+	actions, err := e.CodeActions(ctx, e.sandbox.Workdir.EntireFile(path), nil, protocol.SourceOrganizeImports)
+	if err != nil {
+		return 0, err
+	}
+	strict := version >= 0
+	uri := e.sandbox.Workdir.URI(path)
+	for _, action := range actions {
+		if action.Title == "" {
+			return 0, fmt.Errorf("empty title for code action")
+		}
+		if action.Kind != protocol.SourceOrganizeImports {
+			continue
+		}
+		if strict {
+			if action, err = e.resolveCodeAction(ctx, action); err != nil {
+				return 0, err
+			}
+			if action.Edit != nil {
+				for _, change := range action.Edit.DocumentChanges {
+					if edit := change.TextDocumentEdit; edit != nil && edit.TextDocument.URI == uri {
+						if got := int(edit.TextDocument.Version); got != version {
+							return 0, fmt.Errorf("edits are for version %d, want %d: %w", got, version, ErrVersionChanged)
+						}
+						// Each edit produces a new version.
+						version++
+					}
+				}
+			}
+		}
+		if err := e.applyCodeAction(ctx, action, strict); err != nil {
+			return 0, err
+		}
+	}
+	if !strict {
+		return e.BufferVersion(path), nil
+	}
+	return version, nil
+}
+
 // RefactorRewrite requests and performs the source.refactorRewrite codeAction.
 func (e *Editor) RefactorRewrite(ctx context.Context, loc protocol.Location) error {
 	applied, err := e.applyCodeActions(ctx, loc, nil, protocol.RefactorRewrite)
@@ -950,6 +1686,363 @@ func (e *Editor) RefactorRewrite(ctx context.Context, loc protocol.Location) err
 	return nil
 }
 
+// ChangeSignature performs a "change signature" refactoring described by
+// args, applying the resulting edits to the function declaration and all of
+// its call sites, which may span several files.
+//
+// The edits are requested as a result of the command (args.ResolveEdits is
+// forced to true), so that they are applied by the editor regardless of
+// whether the server supports workspace/applyEdit.
+func (e *Editor) ChangeSignature(ctx context.Context, args command.ChangeSignatureArgs) error {
+	if err := e.checkBufferLocation(args.RemoveParameter); err != nil {
+		return err
+	}
+	args.ResolveEdits = true
+	cmd, err := command.NewChangeSignatureCommand("", args)
+	if err != nil {
+		return err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return err
+	}
+	wsedit, err := marshalUnmarshal[*protocol.WorkspaceEdit](res)
+	if err != nil {
+		return fmt.Errorf("unmarshalling change signature result: %v", err)
+	}
+	if wsedit == nil {
+		return nil // edits were applied by the server
+	}
+	return e.applyWorkspaceEdit(ctx, wsedit)
+}
+
+// RunVulncheck runs govulncheck on the packages of the module in the
+// workdir-relative directory dir, using the gopls.run_govulncheck command,
+// and returns the result once the (asynchronous) run has completed.
+func (e *Editor) RunVulncheck(ctx context.Context, dir string) (*vulncheck.Result, error) {
+	modURI := e.sandbox.Workdir.URI(path.Join(dir, "go.mod"))
+	cmd, err := command.NewRunGovulncheckCommand("", command.VulncheckArgs{
+		URI:     modURI,
+		Pattern: "./...",
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("running govulncheck: %w", err)
+	}
+	run, err := marshalUnmarshal[command.RunVulncheckResult](res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	// The command only starts govulncheck; its progress ends when it is done.
+	if err := e.progress.await(ctx, func() bool { return e.progress.ended[run.Token] }); err != nil {
+		return nil, fmt.Errorf("awaiting govulncheck: %w", err)
+	}
+
+	cmd, err = command.NewFetchVulncheckResultCommand("", command.URIArg{URI: modURI})
+	if err != nil {
+		return nil, err
+	}
+	res, err = e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching govulncheck result: %w", err)
+	}
+	results, err := marshalUnmarshal[map[protocol.DocumentURI]*vulncheck.Result](res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	result, ok := results[modURI]
+	if !ok {
+		return nil, fmt.Errorf("no govulncheck result for %s", modURI)
+	}
+	return result, nil
+}
+
+// ListKnownPackages runs the gopls.list_known_packages command for the file
+// at the given workdir-relative path, returning the paths of packages that
+// may be imported into it.
+func (e *Editor) ListKnownPackages(ctx context.Context, path string) ([]string, error) {
+	cmd, err := command.NewListKnownPackagesCommand("", command.URIArg{
+		URI: e.sandbox.Workdir.URI(path),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing known packages: %w", err)
+	}
+	result, err := marshalUnmarshal[command.ListKnownPackagesResult](res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	return result.Packages, nil
+}
+
+// AddImport runs the gopls.add_import command to add importPath to the
+// imports of the file at the given workdir-relative path. The server applies
+// the resulting edit to the buffer through workspace/applyEdit.
+func (e *Editor) AddImport(ctx context.Context, path, importPath string) error {
+	cmd, err := command.NewAddImportCommand("", command.AddImportArgs{
+		URI:        e.sandbox.Workdir.URI(path),
+		ImportPath: importPath,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	}); err != nil {
+		return fmt.Errorf("adding import %q: %w", importPath, err)
+	}
+	return nil
+}
+
+// StartDebugging runs the gopls.start_debugging command, and returns the URL
+// of the debug server of the gopls instance handling the LSP session. When
+// gopls forwards to a daemon, this is the daemon's debug server.
+func (e *Editor) StartDebugging(ctx context.Context) (string, error) {
+	cmd, err := command.NewStartDebuggingCommand("", command.DebuggingArgs{})
+	if err != nil {
+		return "", err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return "", fmt.Errorf("starting debugging: %w", err)
+	}
+	result, err := marshalUnmarshal[command.DebuggingResult](res)
+	if err != nil {
+		return "", fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	// The daemon, if any, is last in the serving path.
+	if n := len(result.URLs); n > 0 && result.URLs[n-1] != "" {
+		return result.URLs[n-1], nil
+	}
+	return "", fmt.Errorf("no debug server URL in %s result %v", cmd.Command, result.URLs)
+}
+
+// ViewConfig describes the configuration of a server view.
+type ViewConfig struct {
+	command.View // as reported by the gopls.views command
+
+	// GOOS and GOARCH are the effective values for the view, accounting for
+	// the editor's environment and the view's EnvOverlay.
+	GOOS, GOARCH string
+}
+
+// ViewConfig returns the resolved configuration of the server's view
+// containing the file at the given workdir-relative path.
+//
+// If several views contain path, the one with the innermost root is used.
+func (e *Editor) ViewConfig(ctx context.Context, path string) (*ViewConfig, error) {
+	cmd, err := command.NewViewsCommand("")
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing views: %w", err)
+	}
+	views, err := marshalUnmarshal[[]command.View](res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	abs := e.sandbox.Workdir.AbsPath(path)
+	var view *command.View
+	for i, v := range views {
+		root := v.Root.Path()
+		if (root == abs || pathutil.InDir(root, abs)) && (view == nil || len(root) > len(view.Root.Path())) {
+			view = &views[i]
+		}
+	}
+	if view == nil {
+		return nil, fmt.Errorf("no view contains %s", path)
+	}
+
+	// The server's views do not report their build environment, so resolve
+	// it as the server does: by running 'go env' in the view's folder with
+	// the session environment, followed by the view's own overrides.
+	var env []string
+	for k, v := range makeSettings(e.sandbox, e.Config(), nil)["env"].(map[string]string) {
+		env = append(env, k+"="+v)
+	}
+	env = append(env, view.EnvOverlay...)
+	values, err := e.sandbox.GoEnvValues(ctx, view.Folder.Path(), env, "GOOS", "GOARCH")
+	if err != nil {
+		return nil, fmt.Errorf("resolving the environment of view %s: %v", view.ID, err)
+	}
+	return &ViewConfig{View: *view, GOOS: values["GOOS"], GOARCH: values["GOARCH"]}, nil
+}
+
+// addTestKind is the code action kind used by servers that offer to generate
+// a test for the selected function.
+const addTestKind protocol.CodeActionKind = "source.addTest"
+
+// GenerateTest requests and performs the code action that generates a test
+// for the function at loc.
+//
+// Depending on the server, the action may be offered either as a
+// source.addTest or a refactor.rewrite code action. In the latter case,
+// GenerateTest selects the first action whose edit touches a _test.go file.
+//
+// It returns an error if no such action is offered, or if the test file does
+// not exist after the action is applied.
+func (e *Editor) GenerateTest(ctx context.Context, loc protocol.Location) error {
+	if err := e.checkBufferLocation(loc); err != nil {
+		return err
+	}
+	actions, err := e.CodeActions(ctx, loc, nil, addTestKind, protocol.RefactorRewrite)
+	if err != nil {
+		return err
+	}
+	testPath := strings.TrimSuffix(e.sandbox.Workdir.URIToPath(loc.URI), ".go") + "_test.go"
+	for _, action := range actions {
+		action, err := e.resolveCodeAction(ctx, action)
+		if err != nil {
+			return err
+		}
+		if action.Kind != addTestKind && !e.editsFile(action.Edit, testPath) {
+			continue
+		}
+		if err := e.ApplyCodeAction(ctx, action); err != nil {
+			return fmt.Errorf("applying %q: %w", action.Title, err)
+		}
+		if !e.HasBuffer(testPath) {
+			if _, err := e.sandbox.Workdir.ReadFile(testPath); err != nil {
+				return fmt.Errorf("test file %q was not created: %w", testPath, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("no code action to generate a test at %v", loc)
+}
+
+// editsFile reports whether wsedit contains a change to the file with the
+// given workdir-relative path.
+func (e *Editor) editsFile(wsedit *protocol.WorkspaceEdit, path string) bool {
+	if wsedit == nil {
+		return false
+	}
+	uri := e.sandbox.Workdir.URI(path)
+	if _, ok := wsedit.Changes[uri]; ok {
+		return true
+	}
+	for _, change := range wsedit.DocumentChanges {
+		switch {
+		case change.TextDocumentEdit != nil && change.TextDocumentEdit.TextDocument.URI == uri,
+			change.CreateFile != nil && change.CreateFile.URI == uri:
+			return true
+		}
+	}
+	return false
+}
+
+// AssemblyView executes the command of the "Browse assembly" code action for
+// the function enclosing loc, and returns the URL of the assembly listing
+// that the server asked the client to show.
+func (e *Editor) AssemblyView(ctx context.Context, loc protocol.Location) (string, error) {
+	return e.browse(ctx, loc, settings.GoAssembly)
+}
+
+// FreeSymbolsView executes the command of the "Browse free symbols" code
+// action for the selection loc, and returns the URL of the report that the
+// server asked the client to show.
+func (e *Editor) FreeSymbolsView(ctx context.Context, loc protocol.Location) (string, error) {
+	return e.browse(ctx, loc, settings.GoFreeSymbols)
+}
+
+// FetchDoc executes the command of the "Browse documentation" code action at
+// loc, and returns the content of the web page that the server asked the
+// client to show, fetched over HTTP.
+func (e *Editor) FetchDoc(ctx context.Context, loc protocol.Location) (string, error) {
+	url, err := e.browse(ctx, loc, settings.GoDoc)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s: %s", url, resp.Status, bytes.TrimSpace(content))
+	}
+	return string(content), nil
+}
+
+// browse executes the command of the first code action of the given kind at
+// loc, and returns the URL of the web page shown as a result.
+func (e *Editor) browse(ctx context.Context, loc protocol.Location, kind protocol.CodeActionKind) (string, error) {
+	if err := e.checkBufferLocation(loc); err != nil {
+		return "", err
+	}
+	actions, err := e.CodeActions(ctx, loc, nil, kind)
+	if err != nil {
+		return "", err
+	}
+	for _, action := range actions {
+		if action.Kind != kind || action.Command == nil {
+			continue
+		}
+		e.callsMu.Lock()
+		before := len(e.shown)
+		e.callsMu.Unlock()
+		if _, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+			Command:   action.Command.Command,
+			Arguments: action.Command.Arguments,
+		}); err != nil {
+			return "", err
+		}
+		// The command requests showDocument before it returns.
+		e.callsMu.Lock()
+		defer e.callsMu.Unlock()
+		for _, params := range e.shown[before:] {
+			if params.External {
+				return string(params.URI), nil
+			}
+		}
+		return "", fmt.Errorf("%q did not show a web page", action.Title)
+	}
+	return "", fmt.Errorf("no %s code action at %v", kind, loc)
+}
+
+// ShownDocuments returns the parameters of all showDocument requests the
+// server has made so far, in order.
+func (e *Editor) ShownDocuments() []protocol.ShowDocumentParams {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	return slices.Clone(e.shown)
+}
+
 // ApplyQuickFixes requests and performs the quickfix codeAction.
 func (e *Editor) ApplyQuickFixes(ctx context.Context, loc protocol.Location, diagnostics []protocol.Diagnostic) error {
 	applied, err := e.applyCodeActions(ctx, loc, diagnostics, protocol.SourceFixAll, protocol.QuickFix)
@@ -961,47 +2054,135 @@ func (e *Editor) ApplyQuickFixes(ctx context.Context, loc protocol.Location, dia
 
 // ApplyCodeAction applies the given code action.
 func (e *Editor) ApplyCodeAction(ctx context.Context, action protocol.CodeAction) error {
-	// Resolve the code actions if necessary and supported.
-	if action.Edit == nil {
-		editSupport, err := e.EditResolveSupport()
-		if err != nil {
-			return err
-		}
-		if editSupport {
-			ca, err := e.Server.ResolveCodeAction(ctx, &action)
-			if err != nil {
-				return err
-			}
-			action.Edit = ca.Edit
-		}
+	return e.applyCodeAction(ctx, action, false)
+}
+
+// applyCodeAction applies the given code action. Text edits for an old
+// version of a buffer are skipped, or, if strict is set, cause an error
+// wrapping ErrVersionChanged.
+func (e *Editor) applyCodeAction(ctx context.Context, action protocol.CodeAction, strict bool) error {
+	action, err := e.resolveCodeAction(ctx, action)
+	if err != nil {
+		return err
 	}
 
 	if action.Edit != nil {
 		for _, change := range action.Edit.DocumentChanges {
 			if change.TextDocumentEdit != nil {
 				path := e.sandbox.Workdir.URIToPath(change.TextDocumentEdit.TextDocument.URI)
-				if int32(e.buffers[path].version) != change.TextDocumentEdit.TextDocument.Version {
-					// Skip edits for old versions.
-					continue
-				}
-				if err := e.EditBuffer(ctx, path, protocol.AsTextEdits(change.TextDocumentEdit.Edits)); err != nil {
+				version := int(change.TextDocumentEdit.TextDocument.Version)
+				if err := e.editBufferAtVersion(ctx, path, version, protocol.AsTextEdits(change.TextDocumentEdit.Edits)); err != nil {
+					if !strict && errors.Is(err, ErrVersionChanged) {
+						// Skip edits for old versions.
+						continue
+					}
 					return fmt.Errorf("editing buffer %q: %w", path, err)
 				}
+			} else if err := e.applyDocumentChange(ctx, change); err != nil {
+				// A resource operation, such as the creation of a new file.
+				return err
 			}
 		}
 	}
-	// Execute any commands. The specification says that commands are
-	// executed after edits are applied.
-	if action.Command != nil {
-		if _, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
-			Command:   action.Command.Command,
-			Arguments: action.Command.Arguments,
-		}); err != nil {
-			return err
+	// Execute any commands. The specification says that commands are
+	// executed after edits are applied.
+	if action.Command != nil {
+		if _, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+			Command:   action.Command.Command,
+			Arguments: action.Command.Arguments,
+		}); err != nil {
+			return err
+		}
+	}
+	// Some commands may edit files on disk.
+	return e.sandbox.Workdir.CheckForFileChanges(ctx)
+}
+
+// ExtractFunction applies the "Extract function" refactoring to the
+// statements selected by loc, which must be in an open buffer.
+func (e *Editor) ExtractFunction(ctx context.Context, loc protocol.Location) error {
+	actions, err := e.CodeAction(ctx, loc, nil, protocol.CodeActionInvoked)
+	if err != nil {
+		return err
+	}
+	var titles []string
+	for _, action := range actions {
+		if action.Kind == protocol.RefactorExtract && action.Title == "Extract function" {
+			return e.ApplyCodeAction(ctx, action)
+		}
+		titles = append(titles, action.Title)
+	}
+	return fmt.Errorf("no extract function code action at %v (have %q)", loc, titles)
+}
+
+// PreviewCodeAction returns the workspace edit of the code action with the
+// given title at loc, without applying it.
+//
+// If the action does not carry its edit, even after resolution, but instead
+// runs the gopls.apply_fix command, the command is executed in a mode that
+// returns the edit rather than applying it.
+func (e *Editor) PreviewCodeAction(ctx context.Context, loc protocol.Location, title string) (*protocol.WorkspaceEdit, error) {
+	actions, err := e.CodeAction(ctx, loc, nil, protocol.CodeActionInvoked)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(actions, func(action protocol.CodeAction) bool { return action.Title == title })
+	if i < 0 {
+		return nil, fmt.Errorf("no code action %q at %v", title, loc)
+	}
+	action, err := e.resolveCodeAction(ctx, actions[i])
+	if err != nil {
+		return nil, err
+	}
+	if action.Edit != nil {
+		return action.Edit, nil
+	}
+	if action.Command == nil || action.Command.Command != command.ApplyFix.String() {
+		return nil, fmt.Errorf("code action %q has no edit to preview", title)
+	}
+	var args command.ApplyFixArgs
+	if err := command.UnmarshalArgs(action.Command.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("unmarshalling %s arguments: %v", action.Command.Command, err)
+	}
+	args.ResolveEdits = true
+	cmd, err := command.NewApplyFixCommand(action.Command.Title, args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+	if err != nil {
+		return nil, err
+	}
+	wsedit, err := marshalUnmarshal[*protocol.WorkspaceEdit](res)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling %s result: %v", cmd.Command, err)
+	}
+	if wsedit == nil {
+		return nil, fmt.Errorf("code action %q returned no edit to preview", title)
+	}
+	return wsedit, nil
+}
+
+// resolveCodeAction resolves the edit of the given code action, if necessary
+// and supported.
+func (e *Editor) resolveCodeAction(ctx context.Context, action protocol.CodeAction) (protocol.CodeAction, error) {
+	if action.Edit == nil {
+		editSupport, err := e.EditResolveSupport()
+		if err != nil {
+			return action, err
+		}
+		if editSupport {
+			ca, err := e.Server.ResolveCodeAction(ctx, &action)
+			if err != nil {
+				return action, err
+			}
+			action.Edit = ca.Edit
 		}
 	}
-	// Some commands may edit files on disk.
-	return e.sandbox.Workdir.CheckForFileChanges(ctx)
+	return action, nil
 }
 
 // GetQuickFixes returns the available quick fix code actions.
@@ -1009,6 +2190,33 @@ func (e *Editor) GetQuickFixes(ctx context.Context, loc protocol.Location, diagn
 	return e.CodeActions(ctx, loc, diagnostics, protocol.QuickFix, protocol.SourceFixAll)
 }
 
+// PreferredQuickFix returns the quick fix for the given diagnostics at loc
+// that the server marks as preferred, or the first quick fix if none is
+// marked. It returns an error if there are no quick fixes.
+func (e *Editor) PreferredQuickFix(ctx context.Context, loc protocol.Location, diagnostics []protocol.Diagnostic) (*protocol.CodeAction, error) {
+	actions, err := e.GetQuickFixes(ctx, loc, diagnostics)
+	if err != nil {
+		return nil, err
+	}
+	var first *protocol.CodeAction
+	for i := range actions {
+		action := &actions[i]
+		if action.Kind != protocol.QuickFix {
+			continue
+		}
+		if action.IsPreferred {
+			return action, nil
+		}
+		if first == nil {
+			first = action
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no quick fixes at %v", loc)
+	}
+	return first, nil
+}
+
 func (e *Editor) applyCodeActions(ctx context.Context, loc protocol.Location, diagnostics []protocol.Diagnostic, only ...protocol.CodeActionKind) (int, error) {
 	actions, err := e.CodeActions(ctx, loc, diagnostics, only...)
 	if err != nil {
@@ -1051,6 +2259,22 @@ func (e *Editor) CodeActions(ctx context.Context, loc protocol.Location, diagnos
 	return e.Server.CodeAction(ctx, params)
 }
 
+// CodeActionsOfKind requests the code actions at loc whose kind is within
+// the hierarchy of the given kind, such as "refactor.extract" for "refactor".
+// It returns an error if the server returns an action of any other kind.
+func (e *Editor) CodeActionsOfKind(ctx context.Context, loc protocol.Location, kind protocol.CodeActionKind) ([]protocol.CodeAction, error) {
+	actions, err := e.CodeActions(ctx, loc, nil, kind)
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range actions {
+		if action.Kind != kind && !strings.HasPrefix(string(action.Kind), string(kind)+".") {
+			return nil, fmt.Errorf("requested code actions of kind %q, got %q action %q", kind, action.Kind, action.Title)
+		}
+	}
+	return actions, nil
+}
+
 func (e *Editor) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
 	if e.Server == nil {
 		return nil, nil
@@ -1082,22 +2306,103 @@ func (e *Editor) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 
 // FormatBuffer gofmts a Go file.
 func (e *Editor) FormatBuffer(ctx context.Context, path string) error {
+	_, err := e.formatBuffer(ctx, path, -1)
+	return err
+}
+
+// formatBuffer formats the buffer at path, and returns the resulting buffer
+// version. If version is negative, the current version is used. It is an
+// error wrapping ErrVersionChanged if the buffer is not at that version when
+// the formatting edits are received.
+func (e *Editor) formatBuffer(ctx context.Context, path string, version int) (int, error) {
+	if version < 0 {
+		version = e.BufferVersion(path)
+	}
 	if e.Server == nil {
-		return nil
+		return version, nil
 	}
-	e.mu.Lock()
-	version := e.buffers[path].version
-	e.mu.Unlock()
 	params := &protocol.DocumentFormattingParams{}
 	params.TextDocument.URI = e.sandbox.Workdir.URI(path)
 	edits, err := e.Server.Formatting(ctx, params)
 	if err != nil {
-		return fmt.Errorf("textDocument/formatting: %w", err)
+		return 0, fmt.Errorf("textDocument/formatting: %w", err)
+	}
+	if err := e.applyFormattingEdits(ctx, path, version, edits); err != nil {
+		return 0, err
+	}
+	if len(edits) > 0 {
+		version++
+	}
+	return version, nil
+}
+
+// FormatBufferRange formats the range of an editor buffer denoted by loc,
+// using textDocument/rangeFormatting.
+func (e *Editor) FormatBufferRange(ctx context.Context, loc protocol.Location) error {
+	if e.Server == nil {
+		return nil
+	}
+	path := e.sandbox.Workdir.URIToPath(loc.URI)
+	e.mu.Lock()
+	buf, ok := e.buffers[path]
+	e.mu.Unlock()
+	if !ok {
+		return ErrUnknownBuffer
+	}
+	version := buf.version
+	params := &protocol.DocumentRangeFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+		Range:        loc.Range,
+	}
+	edits, err := e.Server.RangeFormatting(ctx, params)
+	if err != nil {
+		return fmt.Errorf("textDocument/rangeFormatting: %w", err)
+	}
+	return e.applyFormattingEdits(ctx, path, version, edits)
+}
+
+// OnTypeFormat requests the formatting edits that result from typing the
+// trigger character ch at loc, and applies them to the buffer. It is an
+// error if ch is not one of the server's on-type formatting trigger
+// characters.
+func (e *Editor) OnTypeFormat(ctx context.Context, loc protocol.Location, ch string) error {
+	if e.Server == nil {
+		return nil
+	}
+	opts := e.serverCapabilities.DocumentOnTypeFormattingProvider
+	if opts == nil {
+		return fmt.Errorf("server does not support on-type formatting")
+	}
+	if ch != opts.FirstTriggerCharacter && !slices.Contains(opts.MoreTriggerCharacter, ch) {
+		return fmt.Errorf("%q is not an on-type formatting trigger character", ch)
+	}
+	path := e.sandbox.Workdir.URIToPath(loc.URI)
+	e.mu.Lock()
+	buf, ok := e.buffers[path]
+	e.mu.Unlock()
+	if !ok {
+		return ErrUnknownBuffer
+	}
+	version := buf.version
+	params := &protocol.DocumentOnTypeFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+		Position:     loc.Range.Start,
+		Ch:           ch,
+	}
+	edits, err := e.Server.OnTypeFormatting(ctx, params)
+	if err != nil {
+		return fmt.Errorf("textDocument/onTypeFormatting: %w", err)
 	}
+	return e.applyFormattingEdits(ctx, path, version, edits)
+}
+
+// applyFormattingEdits applies formatting edits computed against the given
+// version of the buffer at path, failing if the buffer has since changed.
+func (e *Editor) applyFormattingEdits(ctx context.Context, path string, version int, edits []protocol.TextEdit) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	if versionAfter := e.buffers[path].version; versionAfter != version {
-		return fmt.Errorf("before receipt of formatting edits, buffer version changed from %d to %d", version, versionAfter)
+		return fmt.Errorf("%w: before receipt of formatting edits, buffer version changed from %d to %d", ErrVersionChanged, version, versionAfter)
 	}
 	if len(edits) == 0 {
 		return nil
@@ -1140,7 +2445,7 @@ func (e *Editor) RunGenerate(ctx context.Context, dir string) error {
 		Arguments: cmd.Arguments,
 	}
 	if _, err := e.ExecuteCommand(ctx, params); err != nil {
-		return fmt.Errorf("running generate: %v", err)
+		return fmt.Errorf("running generate: %w", err)
 	}
 	// Unfortunately we can't simply poll the workdir for file changes here,
 	// because server-side command may not have completed. In integration tests, we can
@@ -1149,6 +2454,108 @@ func (e *Editor) RunGenerate(ctx context.Context, dir string) error {
 	return nil
 }
 
+// ToggleCompilerOptDetails executes the gopls.toggle_gc_details command for
+// the package in the given workdir-relative directory, toggling the
+// diagnostics that report the compiler's optimization decisions (inlining,
+// escape analysis, and so on).
+//
+// The command identifies the package by one of its files, so dir must
+// contain at least one .go file.
+func (e *Editor) ToggleCompilerOptDetails(ctx context.Context, dir string) error {
+	if e.Server == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(e.sandbox.Workdir.AbsPath(dir))
+	if err != nil {
+		return err
+	}
+	var file string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			file = path.Join(dir, entry.Name())
+			break
+		}
+	}
+	if file == "" {
+		return fmt.Errorf("no .go files in %q", dir)
+	}
+	cmd, err := command.NewToggleGCDetailsCommand("", command.URIArg{
+		URI: e.sandbox.Workdir.URI(file),
+	})
+	if err != nil {
+		return err
+	}
+	params := &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	}
+	if _, err := e.ExecuteCommand(ctx, params); err != nil {
+		return fmt.Errorf("toggling compiler optimization details: %w", err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.compilerOptDetails == nil {
+		e.compilerOptDetails = make(map[string]bool)
+	}
+	dir = path.Clean(dir)
+	e.compilerOptDetails[dir] = !e.compilerOptDetails[dir]
+	return nil
+}
+
+// CompilerOptDetailsEnabled reports whether compiler optimization details
+// are enabled for the package in the given workdir-relative directory, as
+// toggled by ToggleCompilerOptDetails.
+//
+// The state is tracked by the editor, and reflects only toggles made via
+// ToggleCompilerOptDetails. Like the server's, it is session state, so
+// closing and reopening the package's files does not affect it.
+func (e *Editor) CompilerOptDetailsEnabled(dir string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.compilerOptDetails[path.Clean(dir)]
+}
+
+// ResetGoModDiagnostics executes the gopls.reset_go_mod_diagnostics command
+// for the go.mod file at the given workdir-relative path, clearing
+// diagnostics (such as available upgrades) that persist until reset.
+func (e *Editor) ResetGoModDiagnostics(ctx context.Context, path string) error {
+	cmd, err := command.NewResetGoModDiagnosticsCommand("", command.ResetGoModDiagnosticsArgs{
+		URIArg: command.URIArg{URI: e.sandbox.Workdir.URI(path)},
+	})
+	if err != nil {
+		return err
+	}
+	return e.executeMaintenanceCommand(ctx, cmd)
+}
+
+// RegenerateCgo executes the gopls.regenerate_cgo command for the package
+// containing the file at the given workdir-relative path.
+func (e *Editor) RegenerateCgo(ctx context.Context, path string) error {
+	cmd, err := command.NewRegenerateCgoCommand("", command.URIArg{
+		URI: e.sandbox.Workdir.URI(path),
+	})
+	if err != nil {
+		return err
+	}
+	return e.executeMaintenanceCommand(ctx, cmd)
+}
+
+// executeMaintenanceCommand executes a command that modifies the server's
+// state, and checks for any resulting changes to files on disk.
+func (e *Editor) executeMaintenanceCommand(ctx context.Context, cmd protocol.Command) error {
+	if e.Server == nil {
+		return nil
+	}
+	params := &protocol.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	}
+	if _, err := e.ExecuteCommand(ctx, params); err != nil {
+		return fmt.Errorf("executing %s: %w", cmd.Command, err)
+	}
+	return e.sandbox.Workdir.CheckForFileChanges(ctx)
+}
+
 // CodeLens executes a codelens request on the server.
 func (e *Editor) CodeLens(ctx context.Context, path string) ([]protocol.CodeLens, error) {
 	if e.Server == nil {
@@ -1170,6 +2577,36 @@ func (e *Editor) CodeLens(ctx context.Context, path string) ([]protocol.CodeLens
 	return lens, nil
 }
 
+// ResolveCodeLens resolves the given code lens using codeLens/resolve,
+// typically to populate its Command. If no server is connected, it returns
+// (nil, nil).
+func (e *Editor) ResolveCodeLens(ctx context.Context, lens protocol.CodeLens) (*protocol.CodeLens, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	resolved, err := e.Server.ResolveCodeLens(ctx, &lens)
+	if err != nil {
+		return nil, fmt.Errorf("resolving code lens: %w", err)
+	}
+	return resolved, nil
+}
+
+// CodeLensAt returns the code lenses for the buffer at the given path whose
+// range starts on the given (0-based) line.
+func (e *Editor) CodeLensAt(ctx context.Context, path string, line uint32) ([]protocol.CodeLens, error) {
+	lenses, err := e.CodeLens(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var res []protocol.CodeLens
+	for _, lens := range lenses {
+		if lens.Range.Start.Line == line {
+			res = append(res, lens)
+		}
+	}
+	return res, nil
+}
+
 // Completion executes a completion request on the server.
 func (e *Editor) Completion(ctx context.Context, loc protocol.Location) (*protocol.CompletionList, error) {
 	if e.Server == nil {
@@ -1189,9 +2626,43 @@ func (e *Editor) Completion(ctx context.Context, loc protocol.Location) (*protoc
 	if err != nil {
 		return nil, err
 	}
+	if err := applyItemDefaults(completions); err != nil {
+		return nil, err
+	}
 	return completions, nil
 }
 
+// ResolveCompletionItem resolves the lazily computed fields of the given
+// completion item, such as its documentation or additional text edits, using
+// completionItem/resolve. If no server is connected, it returns (nil, nil).
+func (e *Editor) ResolveCompletionItem(ctx context.Context, item protocol.CompletionItem) (*protocol.CompletionItem, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	resolved, err := e.Server.ResolveCompletionItem(ctx, &item)
+	if err != nil {
+		return nil, fmt.Errorf("resolving completion item %q: %w", item.Label, err)
+	}
+	return resolved, nil
+}
+
+// DeprecatedCompletions returns the completion items at loc that the server
+// marks as deprecated, either by the Deprecated tag (which the editor
+// declares support for) or by the legacy deprecated flag.
+func (e *Editor) DeprecatedCompletions(ctx context.Context, loc protocol.Location) ([]protocol.CompletionItem, error) {
+	completions, err := e.Completion(ctx, loc)
+	if err != nil || completions == nil {
+		return nil, err
+	}
+	var deprecated []protocol.CompletionItem
+	for _, item := range completions.Items {
+		if item.Deprecated || slices.Contains(item.Tags, protocol.ComplDeprecated) {
+			deprecated = append(deprecated, item)
+		}
+	}
+	return deprecated, nil
+}
+
 func (e *Editor) SetSuggestionInsertReplaceMode(_ context.Context, useReplaceMode bool) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -1207,6 +2678,15 @@ func (e *Editor) AcceptCompletion(ctx context.Context, loc protocol.Location, it
 	if e.Server == nil {
 		return nil
 	}
+	if e.Config().ResolveCompletionBeforeAccept && item.Data != nil {
+		resolved, err := e.ResolveCompletionItem(ctx, item)
+		if err != nil {
+			return err
+		}
+		if resolved != nil && len(resolved.AdditionalTextEdits) > 0 {
+			item = *resolved
+		}
+	}
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	path := e.sandbox.Workdir.URIToPath(loc.URI)
@@ -1218,9 +2698,44 @@ func (e *Editor) AcceptCompletion(ctx context.Context, loc protocol.Location, it
 	if err != nil {
 		return err
 	}
-	return e.editBufferLocked(ctx, path, append([]protocol.TextEdit{
-		edit,
-	}, item.AdditionalTextEdits...))
+	// Additional edits (such as import insertions) typically precede the
+	// main edit, and must not overlap it.
+	edits, err := sortEdits(append([]protocol.TextEdit{edit}, item.AdditionalTextEdits...))
+	if err != nil {
+		return fmt.Errorf("accepting completion %q: %v", item.Label, err)
+	}
+	return e.editBufferLocked(ctx, path, edits)
+}
+
+// applyItemDefaults sets the textEdit of each item in the completion list
+// that has none of its own, by combining its textEditText (or label) with the
+// default edit range of the list, if any.
+func applyItemDefaults(list *protocol.CompletionList) error {
+	if list == nil || list.ItemDefaults == nil || list.ItemDefaults.EditRange == nil {
+		return nil
+	}
+	for i, item := range list.Items {
+		if item.TextEdit != nil {
+			continue
+		}
+		text := item.TextEditText
+		if text == "" {
+			text = item.Label
+		}
+		switch editRange := list.ItemDefaults.EditRange.Value.(type) {
+		case protocol.Range:
+			list.Items[i].TextEdit = &protocol.Or_CompletionItem_textEdit{Value: protocol.TextEdit{Range: editRange, NewText: text}}
+		case protocol.EditRangeWithInsertReplace:
+			list.Items[i].TextEdit = &protocol.Or_CompletionItem_textEdit{Value: protocol.InsertReplaceEdit{
+				NewText: text,
+				Insert:  editRange.Insert,
+				Replace: editRange.Replace,
+			}}
+		default:
+			return fmt.Errorf("unsupported default edit range type %T", editRange)
+		}
+	}
+	return nil
 }
 
 // Symbols executes a workspace/symbols request on the server.
@@ -1233,13 +2748,72 @@ func (e *Editor) Symbols(ctx context.Context, sym string) ([]protocol.SymbolInfo
 	return ans, err
 }
 
-// CodeLens executes a codelens request on the server.
+// DocumentSymbols executes a textDocument/documentSymbol request for the open
+// buffer at path.
+//
+// The response may consist of either hierarchical DocumentSymbols or (legacy)
+// flat SymbolInformation. In the latter case, each SymbolInformation is
+// converted to a DocumentSymbol without children, whose range and selection
+// range are both the symbol's location, and whose detail is its container
+// name.
+func (e *Editor) DocumentSymbols(ctx context.Context, path string) ([]protocol.DocumentSymbol, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if !e.HasBuffer(path) {
+		return nil, fmt.Errorf("buffer %q is not open", path)
+	}
+	params := &protocol.DocumentSymbolParams{
+		TextDocument: e.TextDocumentIdentifier(path),
+	}
+	resp, err := e.Server.DocumentSymbol(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []protocol.DocumentSymbol
+	for _, elem := range resp {
+		// Each element is a union of SymbolInformation and DocumentSymbol,
+		// distinguished by the presence of a location.
+		probe, err := marshalUnmarshal[struct {
+			Location *protocol.Location `json:"location"`
+		}](elem)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling document symbol: %v", err)
+		}
+		if probe.Location != nil {
+			info, err := marshalUnmarshal[protocol.SymbolInformation](elem)
+			if err != nil {
+				return nil, fmt.Errorf("unmarshalling SymbolInformation: %v", err)
+			}
+			symbols = append(symbols, protocol.DocumentSymbol{
+				Name:           info.Name,
+				Detail:         info.ContainerName,
+				Kind:           info.Kind,
+				Tags:           info.Tags,
+				Deprecated:     info.Deprecated,
+				Range:          info.Location.Range,
+				SelectionRange: info.Location.Range,
+			})
+			continue
+		}
+		sym, err := marshalUnmarshal[protocol.DocumentSymbol](elem)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling DocumentSymbol: %v", err)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, nil
+}
+
+// InlayHint executes an inlay hint request on the server. It returns an error
+// wrapping ErrVersionChanged if the buffer was edited before the response was
+// received, as the hint positions would then be stale.
 func (e *Editor) InlayHint(ctx context.Context, path string) ([]protocol.InlayHint, error) {
 	if e.Server == nil {
 		return nil, nil
 	}
 	e.mu.Lock()
-	_, ok := e.buffers[path]
+	buf, ok := e.buffers[path]
 	e.mu.Unlock()
 	if !ok {
 		return nil, fmt.Errorf("buffer %q is not open", path)
@@ -1247,53 +2821,170 @@ func (e *Editor) InlayHint(ctx context.Context, path string) ([]protocol.InlayHi
 	params := &protocol.InlayHintParams{
 		TextDocument: e.TextDocumentIdentifier(path),
 	}
-	hints, err := e.Server.InlayHint(ctx, params)
+	hints, err := e.Server.InlayHint(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	// The positions of the hints refer to the version of the buffer at the
+	// time of the request.
+	e.mu.Lock()
+	versionAfter := e.buffers[path].version
+	e.mu.Unlock()
+	if versionAfter != buf.version {
+		return nil, fmt.Errorf("%w: before receipt of inlay hints, buffer version changed from %d to %d", ErrVersionChanged, buf.version, versionAfter)
+	}
+	return hints, nil
+}
+
+// ResolveInlayHint resolves the deferred properties of the given inlay hint,
+// such as its tooltip or the locations of its label parts, using
+// inlayHint/resolve. If no server is connected, it returns (nil, nil).
+//
+// Resolution is only valid if the server advertises
+// InlayHintOptions.ResolveProvider.
+func (e *Editor) ResolveInlayHint(ctx context.Context, hint protocol.InlayHint) (*protocol.InlayHint, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	resolved, err := e.Server.Resolve(ctx, &hint)
+	if err != nil {
+		return nil, fmt.Errorf("resolving inlay hint: %w", err)
+	}
+	return resolved, nil
+}
+
+// References returns references to the object at loc, as returned by
+// the connected LSP server. If no server is connected, it returns (nil, nil).
+func (e *Editor) References(ctx context.Context, loc protocol.Location) ([]protocol.Location, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	path := e.sandbox.Workdir.URIToPath(loc.URI)
+	e.mu.Lock()
+	_, ok := e.buffers[path]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("buffer %q is not open", path)
+	}
+	params := &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.LocationTextDocumentPositionParams(loc),
+		Context: protocol.ReferenceContext{
+			IncludeDeclaration: true,
+		},
+	}
+	locations, err := e.Server.References(ctx, params)
 	if err != nil {
 		return nil, err
 	}
-	return hints, nil
+	return locations, nil
 }
 
-// References returns references to the object at loc, as returned by
-// the connected LSP server. If no server is connected, it returns (nil, nil).
-func (e *Editor) References(ctx context.Context, loc protocol.Location) ([]protocol.Location, error) {
+// ReferencesStreaming is like References, but requests that the server
+// stream the results using a partial result token. It calls onChunk with
+// each batch of locations streamed through $/progress notifications, and
+// finally with the locations in the response, if any.
+func (e *Editor) ReferencesStreaming(ctx context.Context, loc protocol.Location, onChunk func([]protocol.Location)) error {
 	if e.Server == nil {
-		return nil, nil
+		return nil
 	}
 	path := e.sandbox.Workdir.URIToPath(loc.URI)
 	e.mu.Lock()
 	_, ok := e.buffers[path]
 	e.mu.Unlock()
 	if !ok {
-		return nil, fmt.Errorf("buffer %q is not open", path)
+		return fmt.Errorf("buffer %q is not open", path)
 	}
+	token, unregister := e.progress.registerPartialResults(func(v any) error {
+		chunk, err := marshalUnmarshal[[]protocol.Location](v)
+		if err != nil {
+			return err
+		}
+		onChunk(chunk)
+		return nil
+	})
+	defer unregister()
 	params := &protocol.ReferenceParams{
 		TextDocumentPositionParams: protocol.LocationTextDocumentPositionParams(loc),
 		Context: protocol.ReferenceContext{
 			IncludeDeclaration: true,
 		},
+		PartialResultParams: protocol.PartialResultParams{
+			PartialResultToken: &token,
+		},
 	}
 	locations, err := e.Server.References(ctx, params)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return locations, nil
+	if len(locations) > 0 {
+		onChunk(locations)
+	}
+	return nil
 }
 
 // Rename performs a rename of the object at loc to newName, using the
 // connected LSP server. If no server is connected, it returns nil.
 func (e *Editor) Rename(ctx context.Context, loc protocol.Location, newName string) error {
-	if e.Server == nil {
+	_, err := e.rename(ctx, loc, newName, nil)
+	return err
+}
+
+// RenameReturningEdit is like Rename, but also returns the workspace edit
+// computed by the server, as it was before the editor applied it, so that
+// tests can assert on the files and edits affected by a rename. If no server
+// is connected, it returns (nil, nil).
+func (e *Editor) RenameReturningEdit(ctx context.Context, loc protocol.Location, newName string) (*protocol.WorkspaceEdit, error) {
+	return e.rename(ctx, loc, newName, nil)
+}
+
+// RenameWithPlaceholderCheck is like Rename, but additionally fails if the
+// placeholder returned by textDocument/prepareRename is not wantPlaceholder.
+func (e *Editor) RenameWithPlaceholderCheck(ctx context.Context, loc protocol.Location, newName, wantPlaceholder string) error {
+	_, err := e.rename(ctx, loc, newName, func(res *protocol.PrepareRenameResult) error {
+		if res == nil {
+			return fmt.Errorf("preparing rename: got no result, want placeholder %q", wantPlaceholder)
+		}
+		if res.Placeholder != wantPlaceholder {
+			return fmt.Errorf("preparing rename: got placeholder %q, want %q", res.Placeholder, wantPlaceholder)
+		}
 		return nil
+	})
+	return err
+}
+
+// PrepareRename checks whether the object at loc can be renamed, using
+// textDocument/prepareRename, and returns the range and placeholder text
+// that the server proposes for the rename. The server may reject the
+// position with either an error or a nil result. If no server is connected,
+// it returns (nil, nil).
+func (e *Editor) PrepareRename(ctx context.Context, loc protocol.Location) (*protocol.PrepareRenameResult, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	params := &protocol.PrepareRenameParams{}
+	params.TextDocument = e.TextDocumentIdentifier(e.sandbox.Workdir.URIToPath(loc.URI))
+	params.Position = loc.Range.Start
+	return e.Server.PrepareRename(ctx, params)
+}
+
+// rename implements Rename, returning the applied workspace edit. If
+// checkPrepare is non-nil, it is called with the result of
+// textDocument/prepareRename, and any error it returns aborts the rename.
+func (e *Editor) rename(ctx context.Context, loc protocol.Location, newName string, checkPrepare func(*protocol.PrepareRenameResult) error) (*protocol.WorkspaceEdit, error) {
+	if e.Server == nil {
+		return nil, nil
 	}
 	path := e.sandbox.Workdir.URIToPath(loc.URI)
 
 	// Verify that PrepareRename succeeds.
-	prepareParams := &protocol.PrepareRenameParams{}
-	prepareParams.TextDocument = e.TextDocumentIdentifier(path)
-	prepareParams.Position = loc.Range.Start
-	if _, err := e.Server.PrepareRename(ctx, prepareParams); err != nil {
-		return fmt.Errorf("preparing rename: %v", err)
+	prepared, err := e.PrepareRename(ctx, loc)
+	if err != nil {
+		return nil, fmt.Errorf("preparing rename: %w", err)
+	}
+	if checkPrepare != nil {
+		if err := checkPrepare(prepared); err != nil {
+			return nil, err
+		}
 	}
 
 	params := &protocol.RenameParams{
@@ -1303,9 +2994,12 @@ func (e *Editor) Rename(ctx context.Context, loc protocol.Location, newName stri
 	}
 	wsedit, err := e.Server.Rename(ctx, params)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return e.applyWorkspaceEdit(ctx, wsedit)
+	if err := e.applyWorkspaceEdit(ctx, wsedit); err != nil {
+		return nil, err
+	}
+	return wsedit, nil
 }
 
 // Implementations returns implementations for the object at loc, as
@@ -1366,9 +3060,91 @@ func (e *Editor) RenameFile(ctx context.Context, oldPath, newPath string) error
 	if err := e.sandbox.Workdir.RenameFile(ctx, oldPath, newPath); err != nil {
 		return fmt.Errorf("renaming sandbox file: %w", err)
 	}
+	return e.DidRenameFiles(ctx, protocol.FileRename{
+		OldURI: string(e.sandbox.Workdir.URI(oldPath)),
+		NewURI: string(e.sandbox.Workdir.URI(newPath)),
+	})
+}
+
+// DidCreateFiles sends a workspace/didCreateFiles notification for the
+// given files, if the server is interested in them.
+//
+// The editor calls it after creating a file as part of a workspace edit, so
+// tests need only call it directly for files created by other means.
+//
+// TODO: honor the filters in the server's file operation options.
+func (e *Editor) DidCreateFiles(ctx context.Context, uris ...protocol.DocumentURI) error {
+	if e.Server == nil || e.fileOperations().DidCreate == nil {
+		return nil
+	}
+	files := make([]protocol.FileCreate, len(uris))
+	for i, uri := range uris {
+		files[i] = protocol.FileCreate{URI: string(uri)}
+	}
+	if err := e.Server.DidCreateFiles(ctx, &protocol.CreateFilesParams{Files: files}); err != nil {
+		return fmt.Errorf("DidCreateFiles: %w", err)
+	}
+	e.callsMu.Lock()
+	e.calls.DidCreateFiles++
+	e.callsMu.Unlock()
+	return nil
+}
+
+// DidRenameFiles sends a workspace/didRenameFiles notification for the given
+// renames, if the server is interested in them.
+//
+// RenameFile calls it after renaming a file on disk, so tests need only call
+// it directly for renames made by other means.
+//
+// TODO: honor the filters in the server's file operation options.
+func (e *Editor) DidRenameFiles(ctx context.Context, renames ...protocol.FileRename) error {
+	if e.Server == nil || e.fileOperations().DidRename == nil {
+		return nil
+	}
+	if err := e.Server.DidRenameFiles(ctx, &protocol.RenameFilesParams{Files: renames}); err != nil {
+		return fmt.Errorf("DidRenameFiles: %w", err)
+	}
+	e.callsMu.Lock()
+	e.calls.DidRenameFiles++
+	e.callsMu.Unlock()
+	return nil
+}
+
+// DidDeleteFiles sends a workspace/didDeleteFiles notification for the
+// given files, if the server is interested in them.
+//
+// The editor calls it after deleting a file as part of a workspace edit, so
+// tests need only call it directly for deletions made by other means.
+//
+// TODO: honor the filters in the server's file operation options.
+func (e *Editor) DidDeleteFiles(ctx context.Context, uris ...protocol.DocumentURI) error {
+	if e.Server == nil || e.fileOperations().DidDelete == nil {
+		return nil
+	}
+	files := make([]protocol.FileDelete, len(uris))
+	for i, uri := range uris {
+		files[i] = protocol.FileDelete{URI: string(uri)}
+	}
+	if err := e.Server.DidDeleteFiles(ctx, &protocol.DeleteFilesParams{Files: files}); err != nil {
+		return fmt.Errorf("DidDeleteFiles: %w", err)
+	}
+	e.callsMu.Lock()
+	e.calls.DidDeleteFiles++
+	e.callsMu.Unlock()
 	return nil
 }
 
+// fileOperations returns the file operations the server is interested in.
+// The result is non-nil.
+func (e *Editor) fileOperations() *protocol.FileOperationOptions {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ws := e.serverCapabilities.Workspace; ws != nil && ws.FileOperations != nil {
+		return ws.FileOperations
+	}
+	return &protocol.FileOperationOptions{}
+}
+
 // renameBuffers renames in-memory buffers affected by the renaming of
 // oldPath->newPath, returning the resulting text documents that must be closed
 // and opened over the LSP.
@@ -1421,38 +3197,54 @@ func (e *Editor) renameBuffers(oldPath, newPath string) (closed []protocol.TextD
 //   - cmdClient.applyWorkspaceEdit in ../../../cmd/cmd.go for the
 //     CLI variant.
 func (e *Editor) applyWorkspaceEdit(ctx context.Context, wsedit *protocol.WorkspaceEdit) error {
-	uriToPath := e.sandbox.Workdir.URIToPath
+	_, err := e.applyDocumentChanges(ctx, wsedit.DocumentChanges)
+	return err
+}
 
-	for _, change := range wsedit.DocumentChanges {
-		switch {
-		case change.TextDocumentEdit != nil:
-			if err := e.applyTextDocumentEdit(ctx, *change.TextDocumentEdit); err != nil {
-				return err
-			}
+// applyDocumentChanges applies the given document changes in order. If one
+// fails, it stops, returning the index of the failed change and its error.
+func (e *Editor) applyDocumentChanges(ctx context.Context, changes []protocol.DocumentChange) (int, error) {
+	for i, change := range changes {
+		if err := e.applyDocumentChange(ctx, change); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
 
-		case change.RenameFile != nil:
-			old := uriToPath(change.RenameFile.OldURI)
-			new := uriToPath(change.RenameFile.NewURI)
-			return e.RenameFile(ctx, old, new)
+func (e *Editor) applyDocumentChange(ctx context.Context, change protocol.DocumentChange) error {
+	uriToPath := e.sandbox.Workdir.URIToPath
 
-		case change.CreateFile != nil:
-			path := uriToPath(change.CreateFile.URI)
-			if err := e.CreateBuffer(ctx, path, ""); err != nil {
-				return err // e.g. already exists
-			}
+	switch {
+	case change.TextDocumentEdit != nil:
+		return e.applyTextDocumentEdit(ctx, *change.TextDocumentEdit)
 
-		case change.DeleteFile != nil:
-			path := uriToPath(change.CreateFile.URI)
-			_ = e.CloseBuffer(ctx, path) // returns error if not open
-			if err := e.sandbox.Workdir.RemoveFile(ctx, path); err != nil {
-				return err // e.g. doesn't exist
-			}
+	case change.RenameFile != nil:
+		old := uriToPath(change.RenameFile.OldURI)
+		new := uriToPath(change.RenameFile.NewURI)
+		return e.RenameFile(ctx, old, new)
 
-		default:
-			return bug.Errorf("invalid DocumentChange")
+	case change.CreateFile != nil:
+		path := uriToPath(change.CreateFile.URI)
+		if err := e.CreateBuffer(ctx, path, ""); err != nil {
+			return err // e.g. already exists
+		}
+		return e.DidCreateFiles(ctx, change.CreateFile.URI)
+
+	case change.DeleteFile != nil:
+		path := uriToPath(change.DeleteFile.URI)
+		// Close the buffer, if open.
+		if err := e.CloseBuffer(ctx, path); err != nil && !errors.Is(err, ErrUnknownBuffer) {
+			return err
 		}
+		if err := e.sandbox.Workdir.RemoveFile(ctx, path); err != nil {
+			return err // e.g. doesn't exist
+		}
+		return e.DidDeleteFiles(ctx, change.DeleteFile.URI)
+
+	default:
+		return bug.Errorf("invalid DocumentChange")
 	}
-	return nil
 }
 
 func (e *Editor) applyTextDocumentEdit(ctx context.Context, change protocol.TextDocumentEdit) error {
@@ -1473,7 +3265,28 @@ func (e *Editor) applyTextDocumentEdit(ctx context.Context, change protocol.Text
 			return err
 		}
 	}
-	return e.EditBuffer(ctx, path, protocol.AsTextEdits(change.Edits))
+	if err := e.EditBuffer(ctx, path, protocol.AsTextEdits(change.Edits)); err != nil {
+		return err
+	}
+	// AsTextEdits discards annotations, so record them separately.
+	for _, edit := range change.Edits {
+		if x, ok := edit.Value.(protocol.AnnotatedTextEdit); ok && x.AnnotationID != nil {
+			e.callsMu.Lock()
+			e.annotations = append(e.annotations, *x.AnnotationID)
+			e.callsMu.Unlock()
+		}
+	}
+	return nil
+}
+
+// AppliedAnnotations returns the change annotation identifiers of the
+// annotated text edits the editor has applied as part of workspace edits, in
+// order of application. Edits are applied whether or not their annotation
+// requires confirmation.
+func (e *Editor) AppliedAnnotations() []protocol.ChangeAnnotationIdentifier {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	return slices.Clone(e.annotations)
 }
 
 // Config returns the current editor configuration.
@@ -1496,17 +3309,112 @@ func (e *Editor) SetConfig(cfg EditorConfig) {
 func (e *Editor) ChangeConfiguration(ctx context.Context, newConfig EditorConfig) error {
 	e.SetConfig(newConfig)
 	if e.Server != nil {
-		var params protocol.DidChangeConfigurationParams // empty: gopls ignores the Settings field
+		var params protocol.DidChangeConfigurationParams // empty by default: gopls ignores the Settings field
+		if newConfig.PushConfiguration {
+			params.Settings = makeSettings(e.sandbox, newConfig, nil)
+		}
 		if err := e.Server.DidChangeConfiguration(ctx, &params); err != nil {
 			return err
 		}
 		e.callsMu.Lock()
 		e.calls.DidChangeConfiguration++
+		e.lastConfigChange = &params
 		e.callsMu.Unlock()
 	}
 	return nil
 }
 
+// LastConfigurationChange returns the parameters of the most recent
+// didChangeConfiguration notification sent to the server. The second result
+// reports whether any such notification has been sent.
+//
+// Unless EditorConfig.PushConfiguration is set, the Settings field is nil.
+func (e *Editor) LastConfigurationChange() (protocol.DidChangeConfigurationParams, bool) {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	if e.lastConfigChange == nil {
+		return protocol.DidChangeConfigurationParams{}, false
+	}
+	return *e.lastConfigChange, true
+}
+
+// SetAnalyzerEnabled enables or disables the named analyzer through the
+// "analyses" setting, and notifies the server of the configuration change.
+// Other settings, including the state of other analyzers, are preserved.
+func (e *Editor) SetAnalyzerEnabled(ctx context.Context, name string, enabled bool) error {
+	return e.changeSettings(ctx, func(settings map[string]any) error {
+		analyses := make(map[string]any)
+		switch old := settings["analyses"].(type) {
+		case nil:
+		case map[string]any:
+			for k, v := range old {
+				analyses[k] = v
+			}
+		case map[string]bool:
+			for k, v := range old {
+				analyses[k] = v
+			}
+		default:
+			return fmt.Errorf("unexpected type %T for analyses setting", old)
+		}
+		analyses[name] = enabled
+		settings["analyses"] = analyses
+		return nil
+	})
+}
+
+// SymbolsWithMatcher sets the "symbolMatcher" setting to matcher, notifies
+// the server of the configuration change, and then executes a
+// workspace/symbol request for query.
+func (e *Editor) SymbolsWithMatcher(ctx context.Context, matcher settings.SymbolMatcher, query string) ([]protocol.SymbolInformation, error) {
+	if err := e.changeSettings(ctx, func(settings map[string]any) error {
+		settings["symbolMatcher"] = string(matcher)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return e.Symbols(ctx, query)
+}
+
+// CompletionWithBudget sets the "completionBudget" setting to budget,
+// notifies the server of the configuration change, and then executes a
+// completion request at loc. The previous configuration is restored
+// afterwards.
+//
+// The fake editor otherwise disables the completion budget, to avoid flaky
+// results; a positive budget allows tests to exercise truncation of slow
+// completion searches.
+func (e *Editor) CompletionWithBudget(ctx context.Context, loc protocol.Location, budget time.Duration) (_ *protocol.CompletionList, err error) {
+	old := e.Config()
+	if err := e.changeSettings(ctx, func(settings map[string]any) error {
+		settings["completionBudget"] = budget.String()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err2 := e.ChangeConfiguration(ctx, old); err == nil {
+			err = err2
+		}
+	}()
+	return e.Completion(ctx, loc)
+}
+
+// changeSettings applies update to a copy of the editor's settings, and
+// changes the editor configuration to use the result.
+func (e *Editor) changeSettings(ctx context.Context, update func(settings map[string]any) error) error {
+	config := e.Config()
+	settings := make(map[string]any)
+	for k, v := range config.Settings {
+		settings[k] = v
+	}
+	if err := update(settings); err != nil {
+		return err
+	}
+	config.Settings = settings
+	return e.ChangeConfiguration(ctx, config)
+}
+
 // ChangeWorkspaceFolders sets the new workspace folders, and sends a
 // didChangeWorkspaceFolders notification to the server.
 //
@@ -1553,7 +3461,19 @@ func (e *Editor) ChangeWorkspaceFolders(ctx context.Context, folders []string) e
 		params.Event.Removed = append(params.Event.Removed, v)
 	}
 
-	return e.Server.DidChangeWorkspaceFolders(ctx, &params)
+	if err := e.Server.DidChangeWorkspaceFolders(ctx, &params); err != nil {
+		return err
+	}
+	e.callsMu.Lock()
+	e.calls.DidChangeWorkspaceFolders++
+	e.callsMu.Unlock()
+	return nil
+}
+
+// ClearWorkspaceFolders removes all workspace folders, sending a
+// didChangeWorkspaceFolders notification to the server.
+func (e *Editor) ClearWorkspaceFolders(ctx context.Context) error {
+	return e.ChangeWorkspaceFolders(ctx, []string{})
 }
 
 // CodeAction executes a codeAction request on the server.
@@ -1614,6 +3534,49 @@ func (e *Editor) Hover(ctx context.Context, loc protocol.Location) (*protocol.Ma
 	return &resp.Contents, protocol.Location{URI: loc.URI, Range: resp.Range}, nil
 }
 
+// HoverImport hovers over the first occurrence of the quoted import path
+// importPath in the buffer at path, returning the hover content.
+func (e *Editor) HoverImport(ctx context.Context, path, importPath string) (*protocol.MarkupContent, error) {
+	loc, err := e.RegexpSearch(path, `"(`+regexp.QuoteMeta(importPath)+`)"`)
+	if err != nil {
+		return nil, fmt.Errorf("locating import %q: %w", importPath, err)
+	}
+	content, _, err := e.Hover(ctx, loc)
+	return content, err
+}
+
+// FoldingRange returns the folding ranges for the buffer at path, as
+// returned by the connected LSP server. If no server is connected, it
+// returns (nil, nil).
+func (e *Editor) FoldingRange(ctx context.Context, path string) ([]protocol.FoldingRange, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if !e.HasBuffer(path) {
+		return nil, fmt.Errorf("buffer %q is not open", path)
+	}
+	params := &protocol.FoldingRangeParams{
+		TextDocument: e.TextDocumentIdentifier(path),
+	}
+	return e.Server.FoldingRange(ctx, params)
+}
+
+// ImportFoldingRange returns the folding range of kind "imports" for the
+// buffer at path, which covers its import block. It returns an error if the
+// server reports no such range.
+func (e *Editor) ImportFoldingRange(ctx context.Context, path string) (*protocol.FoldingRange, error) {
+	ranges, err := e.FoldingRange(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		if r.Kind == string(protocol.Imports) {
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("no imports folding range in %q", path)
+}
+
 func (e *Editor) DocumentLink(ctx context.Context, path string) ([]protocol.DocumentLink, error) {
 	if e.Server == nil {
 		return nil, nil
@@ -1623,6 +3586,53 @@ func (e *Editor) DocumentLink(ctx context.Context, path string) ([]protocol.Docu
 	return e.Server.DocumentLink(ctx, params)
 }
 
+// DocumentColor returns the color references in the buffer at path, using
+// textDocument/documentColor.
+func (e *Editor) DocumentColor(ctx context.Context, path string) ([]protocol.ColorInformation, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if !e.HasBuffer(path) {
+		return nil, fmt.Errorf("buffer %q is not open", path)
+	}
+	params := &protocol.DocumentColorParams{
+		TextDocument: e.TextDocumentIdentifier(path),
+	}
+	return e.Server.DocumentColor(ctx, params)
+}
+
+// ColorPresentation returns the presentations of color for the range of
+// loc, using textDocument/colorPresentation.
+func (e *Editor) ColorPresentation(ctx context.Context, loc protocol.Location, color protocol.Color) ([]protocol.ColorPresentation, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if err := e.checkBufferLocation(loc); err != nil {
+		return nil, err
+	}
+	params := &protocol.ColorPresentationParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+		Color:        color,
+		Range:        loc.Range,
+	}
+	return e.Server.ColorPresentation(ctx, params)
+}
+
+// Moniker returns the monikers of the symbol at the start of loc, using
+// textDocument/moniker.
+func (e *Editor) Moniker(ctx context.Context, loc protocol.Location) ([]protocol.Moniker, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	if err := e.checkBufferLocation(loc); err != nil {
+		return nil, err
+	}
+	params := &protocol.MonikerParams{
+		TextDocumentPositionParams: protocol.LocationTextDocumentPositionParams(loc),
+	}
+	return e.Server.Moniker(ctx, params)
+}
+
 func (e *Editor) DocumentHighlight(ctx context.Context, loc protocol.Location) ([]protocol.DocumentHighlight, error) {
 	if e.Server == nil {
 		return nil, nil
@@ -1637,6 +3647,30 @@ func (e *Editor) DocumentHighlight(ctx context.Context, loc protocol.Location) (
 	return e.Server.DocumentHighlight(ctx, params)
 }
 
+// SelectionRange returns the selection ranges at the start of each of the
+// given locations, which must all be in the same open buffer. The result
+// contains one SelectionRange per location, in order.
+//
+// If no server is connected, it returns (nil, nil).
+func (e *Editor) SelectionRange(ctx context.Context, loc protocol.Location, more ...protocol.Location) ([]protocol.SelectionRange, error) {
+	if e.Server == nil {
+		return nil, nil
+	}
+	params := &protocol.SelectionRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+	}
+	for _, l := range append([]protocol.Location{loc}, more...) {
+		if l.URI != loc.URI {
+			return nil, fmt.Errorf("selection range locations are in different documents: %s and %s", loc.URI, l.URI)
+		}
+		if err := e.checkBufferLocation(l); err != nil {
+			return nil, err
+		}
+		params.Positions = append(params.Positions, l.Range.Start)
+	}
+	return e.Server.SelectionRange(ctx, params)
+}
+
 // SemanticTokensFull invokes textDocument/semanticTokens/full, and interprets
 // its result.
 func (e *Editor) SemanticTokensFull(ctx context.Context, path string) ([]SemanticToken, error) {
@@ -1649,11 +3683,27 @@ func (e *Editor) SemanticTokensFull(ctx context.Context, path string) ([]Semanti
 	if err != nil {
 		return nil, err
 	}
-	content, ok := e.BufferText(path)
-	if !ok {
-		return nil, fmt.Errorf("buffer %s is not open", path)
+	mapper, err := e.Mapper(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.interpretTokens(resp.Data, mapper)
+}
+
+// SemanticTokensFullOfType is like SemanticTokensFull, but returns only those
+// tokens whose type is one of the given types.
+func (e *Editor) SemanticTokensFullOfType(ctx context.Context, path string, types ...string) ([]SemanticToken, error) {
+	toks, err := e.SemanticTokensFull(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	filtered := toks[:0]
+	for _, tok := range toks {
+		if slices.Contains(types, tok.TokenType) {
+			filtered = append(filtered, tok)
+		}
 	}
-	return e.interpretTokens(resp.Data, content), nil
+	return filtered, nil
 }
 
 // SemanticTokensRange invokes textDocument/semanticTokens/range, and
@@ -1669,11 +3719,35 @@ func (e *Editor) SemanticTokensRange(ctx context.Context, loc protocol.Location)
 	}
 	path := e.sandbox.Workdir.URIToPath(loc.URI)
 	// As noted above: buffers should be keyed by protocol.DocumentURI.
-	content, ok := e.BufferText(path)
-	if !ok {
-		return nil, fmt.Errorf("buffer %s is not open", path)
+	mapper, err := e.Mapper(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.interpretTokens(resp.Data, mapper)
+}
+
+// SemanticTokensFullAndRange returns the semantic tokens of the entire
+// buffer at path twice: as returned by textDocument/semanticTokens/full, and
+// as returned by textDocument/semanticTokens/range over the whole buffer.
+// The two should be the same.
+func (e *Editor) SemanticTokensFullAndRange(ctx context.Context, path string) (full, rng []SemanticToken, _ error) {
+	mapper, err := e.Mapper(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := mapper.OffsetLocation(0, len(mapper.Content))
+	if err != nil {
+		return nil, nil, err
+	}
+	full, err = e.SemanticTokensFull(ctx, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("full tokens: %w", err)
+	}
+	rng, err = e.SemanticTokensRange(ctx, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("range tokens: %w", err)
 	}
-	return e.interpretTokens(resp.Data, content), nil
+	return full, rng, nil
 }
 
 // A SemanticToken is an interpreted semantic token value.
@@ -1681,22 +3755,32 @@ type SemanticToken struct {
 	Token     string
 	TokenType string
 	Mod       string
+
+	// Range is the extent of the token, in the position encoding of the
+	// session.
+	Range protocol.Range
 }
 
+// interpretTokens decodes the semantic token data x, using mapper to
+// resolve token text.
+//
+// Token columns and lengths are expressed in UTF-16 code units, the position
+// encoding of the session, so they are converted to byte offsets using the
+// mapper rather than used to slice the content directly.
+//
 // Note: previously this function elided comment, string, and number tokens.
 // Instead, filtering of token types should be done by the caller.
-func (e *Editor) interpretTokens(x []uint32, contents string) []SemanticToken {
+func (e *Editor) interpretTokens(x []uint32, mapper *protocol.Mapper) ([]SemanticToken, error) {
 	e.mu.Lock()
 	legend := e.semTokOpts.Legend
 	e.mu.Unlock()
-	lines := strings.Split(contents, "\n")
 	ans := []SemanticToken{}
-	line, col := 1, 1
+	var line, col uint32
 	for i := 0; i < len(x); i += 5 {
-		line += int(x[i])
-		col += int(x[i+1])
+		line += x[i]
+		col += x[i+1]
 		if x[i] != 0 { // new line
-			col = int(x[i+1]) + 1 // 1-based column numbers
+			col = x[i+1]
 		}
 		sz := x[i+2]
 		t := legend.TokenTypes[x[i+3]]
@@ -1707,10 +3791,20 @@ func (e *Editor) interpretTokens(x []uint32, contents string) []SemanticToken {
 				mods = append(mods, mod)
 			}
 		}
-		// Preexisting note: "col is a utf-8 offset"
-		// TODO(rfindley): is that true? Or is it UTF-16, like other columns in the LSP?
-		tok := lines[line-1][col-1 : col-1+int(sz)]
-		ans = append(ans, SemanticToken{tok, t, strings.Join(mods, " ")})
+		rng := protocol.Range{
+			Start: protocol.Position{Line: line, Character: col},
+			End:   protocol.Position{Line: line, Character: col + sz},
+		}
+		start, end, err := mapper.RangeOffsets(rng)
+		if err != nil {
+			return nil, fmt.Errorf("semantic token %d: %v", i/5, err)
+		}
+		ans = append(ans, SemanticToken{
+			Token:     string(mapper.Content[start:end]),
+			TokenType: t,
+			Mod:       strings.Join(mods, " "),
+			Range:     rng,
+		})
 	}
-	return ans
+	return ans, nil
 }
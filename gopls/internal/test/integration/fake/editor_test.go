@@ -6,9 +6,22 @@ package fake
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
 
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/tools/gopls/internal/protocol"
+	"golang.org/x/tools/gopls/internal/util/slices"
+	"golang.org/x/tools/internal/jsonrpc2"
+	"golang.org/x/tools/internal/jsonrpc2/servertest"
 )
 
 const exampleProgram = `
@@ -24,6 +37,80 @@ func main() {
 }
 `
 
+// newTestSandbox returns a new sandbox containing the given txtar-encoded
+// files, which is closed at the end of the test.
+func newTestSandbox(t *testing.T, files string) *Sandbox {
+	t.Helper()
+	ws, err := NewSandbox(&SandboxConfig{Files: UnpackTxt(files)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// newTestEditor returns an editor for a new sandbox containing the given
+// txtar-encoded files. If server is non-nil, the editor sends its requests
+// and notifications to it.
+func newTestEditor(t *testing.T, files string, server protocol.Server) (*Editor, *Sandbox) {
+	t.Helper()
+	ws := newTestSandbox(t, files)
+	editor := NewEditor(ws, EditorConfig{})
+	if server != nil {
+		editor.Server = server
+	}
+	return editor, ws
+}
+
+// newConnectedEditor returns an editor with the given configuration for a new
+// sandbox containing exampleProgram, connected over a pipe to a server that
+// answers initialize and passes all other messages to handler. The
+// connection is closed at the end of the test.
+func newConnectedEditor(t *testing.T, config EditorConfig, handler jsonrpc2.Handler) (*Editor, *Sandbox) {
+	t.Helper()
+	ws := newTestSandbox(t, exampleProgram)
+	editor := NewEditor(ws, config)
+	server := func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "initialize" {
+			return reply(ctx, &protocol.InitializeResult{}, nil)
+		}
+		return handler(ctx, reply, req)
+	}
+	ss := servertest.NewPipeServer(jsonrpc2.HandlerServer(server), nil)
+	if _, err := editor.Connect(context.Background(), ss, ClientHooks{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(editor.cancelConn)
+	return editor, ws
+}
+
+// openPrintln opens main.go of exampleProgram, and returns the location of
+// its call to Println.
+func openPrintln(t *testing.T, editor *Editor) protocol.Location {
+	t.Helper()
+	if err := editor.OpenFile(context.Background(), "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("main.go", "Println")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// stubServer is the basis of the stub servers in these tests. It accepts the
+// text synchronization notifications sent by the editor; other methods panic
+// unless implemented by the embedding type.
+type stubServer struct {
+	protocol.Server // unimplemented methods panic
+}
+
+func (stubServer) DidOpen(context.Context, *protocol.DidOpenTextDocumentParams) error     { return nil }
+func (stubServer) DidChange(context.Context, *protocol.DidChangeTextDocumentParams) error { return nil }
+func (stubServer) DidClose(context.Context, *protocol.DidCloseTextDocumentParams) error   { return nil }
+func (stubServer) WillSave(context.Context, *protocol.WillSaveTextDocumentParams) error   { return nil }
+func (stubServer) DidSave(context.Context, *protocol.DidSaveTextDocumentParams) error     { return nil }
+
 func TestClientEditing(t *testing.T) {
 	ws, err := NewSandbox(&SandboxConfig{Files: UnpackTxt(exampleProgram)})
 	if err != nil {
@@ -59,3 +146,1833 @@ func main() {
 		t.Errorf("got text %q, want %q", got, want)
 	}
 }
+
+func TestLastContentChanges(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if got := editor.LastContentChanges("main.go"); got != nil {
+		t.Errorf("LastContentChanges before editing = %v, want nil", got)
+	}
+
+	// A single edit is sent incrementally.
+	edit := protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 5, Character: 14},
+			End:   protocol.Position{Line: 5, Character: 26},
+		},
+		NewText: "Hola, mundo.",
+	}
+	if err := editor.EditBuffer(ctx, "main.go", []protocol.TextEdit{edit}); err != nil {
+		t.Fatal(err)
+	}
+	changes := editor.LastContentChanges("main.go")
+	if len(changes) != 1 || changes[0].Range == nil || *changes[0].Range != edit.Range || changes[0].Text != edit.NewText {
+		t.Errorf("LastContentChanges after one edit = %v, want incremental change %v", changes, edit)
+	}
+
+	// Multiple edits are sent as a full content change.
+	if err := editor.EditBuffer(ctx, "main.go", []protocol.TextEdit{
+		{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 0, Character: 8},
+				End:   protocol.Position{Line: 0, Character: 12},
+			},
+			NewText: "hola",
+		},
+		{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 4, Character: 5},
+				End:   protocol.Position{Line: 4, Character: 9},
+			},
+			NewText: "hola",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := editor.BufferText("main.go")
+	changes = editor.LastContentChanges("main.go")
+	if len(changes) != 1 || changes[0].Range != nil || changes[0].Text != text {
+		t.Errorf("LastContentChanges after two edits = %v, want full content %q", changes, text)
+	}
+}
+
+func TestEditBufferIncremental(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := editor.BufferText("main.go")
+
+	edits := []protocol.TextEdit{
+		NewEdit(0, 8, 0, 12, "hola"),
+		NewEdit(4, 5, 4, 9, "hola"),
+	}
+	if err := editor.EditBufferIncremental(ctx, "main.go", edits); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each edit is sent as its own change, starting from the end of the file.
+	changes := editor.LastContentChanges("main.go")
+	if len(changes) != 2 || changes[0].Range == nil || *changes[0].Range != edits[1].Range || changes[1].Range == nil || *changes[1].Range != edits[0].Range {
+		t.Fatalf("LastContentChanges = %v, want incremental changes for %v in reverse order", changes, edits)
+	}
+
+	// Applying the changes in sequence must produce the buffer content.
+	content := []byte(before)
+	for _, change := range changes {
+		mapper := protocol.NewMapper("", content)
+		var err error
+		content, err = applyEdits(mapper, []protocol.TextEdit{{Range: *change.Range, NewText: change.Text}}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := editor.BufferText("main.go"); string(content) != got {
+		t.Errorf("applying changes sequentially gives %q, want buffer content %q", content, got)
+	}
+
+	if err := editor.EditBufferIncremental(ctx, "main.go", []protocol.TextEdit{
+		NewEdit(0, 0, 0, 4, "a"),
+		NewEdit(0, 2, 0, 6, "b"),
+	}); err == nil {
+		t.Error("EditBufferIncremental with overlapping edits succeeded")
+	}
+}
+
+func TestApplyItemDefaults(t *testing.T) {
+	const content = "fmt.Pri()"
+	insert := protocol.Range{
+		Start: protocol.Position{Line: 0, Character: 4},
+		End:   protocol.Position{Line: 0, Character: 7},
+	}
+	replace := protocol.Range{Start: insert.Start, End: protocol.Position{Line: 0, Character: 9}}
+	defaults := func(editRange any) *protocol.CompletionItemDefaults {
+		return &protocol.CompletionItemDefaults{
+			EditRange: &protocol.Or_CompletionItemDefaults_editRange{Value: editRange},
+		}
+	}
+	tests := []struct {
+		label          string
+		item           protocol.CompletionItem
+		defaults       *protocol.CompletionItemDefaults
+		useReplaceMode bool
+		want           string
+	}{
+		{
+			label:    "textEditText",
+			item:     protocol.CompletionItem{Label: "Println", TextEditText: "Println(${1:})"},
+			defaults: defaults(insert),
+			want:     "fmt.Println(${1:})()",
+		},
+		{
+			label:    "label",
+			item:     protocol.CompletionItem{Label: "Println"},
+			defaults: defaults(insert),
+			want:     "fmt.Println()",
+		},
+		{
+			label:          "insert/replace",
+			item:           protocol.CompletionItem{Label: "Println", TextEditText: "Println"},
+			defaults:       defaults(protocol.EditRangeWithInsertReplace{Insert: insert, Replace: replace}),
+			useReplaceMode: true,
+			want:           "fmt.Println",
+		},
+		{
+			label: "own textEdit",
+			item: protocol.CompletionItem{
+				Label:        "Println",
+				TextEditText: "Printf",
+				TextEdit: &protocol.Or_CompletionItem_textEdit{
+					Value: protocol.TextEdit{Range: insert, NewText: "Print"},
+				},
+			},
+			defaults: defaults(replace),
+			want:     "fmt.Print()",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			list := &protocol.CompletionList{
+				ItemDefaults: test.defaults,
+				Items:        []protocol.CompletionItem{test.item},
+			}
+			if err := applyItemDefaults(list); err != nil {
+				t.Fatal(err)
+			}
+			edit, err := protocol.SelectCompletionTextEdit(list.Items[0], test.useReplaceMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyEdits(protocol.NewMapper("", []byte(content)), []protocol.TextEdit{edit}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(got); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// editingServer is a stub server that edits a buffer of its editor while
+// handling an inlay hint request.
+type editingServer struct {
+	stubServer
+	editor *Editor
+}
+
+func (s *editingServer) InlayHint(ctx context.Context, _ *protocol.InlayHintParams) ([]protocol.InlayHint, error) {
+	if err := s.editor.EditBuffer(ctx, "main.go", []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// edited\n")}); err != nil {
+		return nil, err
+	}
+	return []protocol.InlayHint{{Label: []protocol.InlayHintLabelPart{{Value: "stale"}}}}, nil
+}
+
+func TestInlayHintVersionChanged(t *testing.T) {
+	server := &editingServer{}
+	editor, _ := newTestEditor(t, exampleProgram, server)
+	server.editor = editor
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	hints, err := editor.InlayHint(ctx, "main.go")
+	if !errors.Is(err, ErrVersionChanged) {
+		t.Errorf("InlayHint = %v, %v; want error %v", hints, err, ErrVersionChanged)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	// The server responds to everything but hover requests, which hang until
+	// the end of the test.
+	release := make(chan struct{})
+	defer close(release)
+	editor, _ := newConnectedEditor(t, EditorConfig{RequestTimeout: time.Second}, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/hover" {
+			<-release
+		}
+		return reply(ctx, nil, nil)
+	})
+	loc := openPrintln(t, editor)
+
+	_, _, err := editor.Hover(context.Background(), loc)
+	if err == nil || !strings.Contains(err.Error(), "textDocument/hover") || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Hover: got error %v, want a timeout naming textDocument/hover", err)
+	}
+}
+
+func TestResponseErrorCode(t *testing.T) {
+	// The server reports that the document was modified while computing a
+	// hover, as if the request had raced an edit.
+	editor, _ := newConnectedEditor(t, EditorConfig{}, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/hover" {
+			return reply(ctx, nil, jsonrpc2.NewError(int64(protocol.ContentModified), "content modified"))
+		}
+		return reply(ctx, nil, nil)
+	})
+	loc := openPrintln(t, editor)
+
+	_, _, err := editor.Hover(context.Background(), loc)
+	if !errors.Is(err, ContentModified) {
+		t.Fatalf("Hover: got error %v, want ContentModified", err)
+	}
+	if errors.Is(err, RequestCancelled) {
+		t.Errorf("Hover: error %v unexpectedly matches RequestCancelled", err)
+	}
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Method != "textDocument/hover" || respErr.Message != "content modified" {
+		t.Errorf("Hover: got error %#v, want a ResponseError for textDocument/hover", err)
+	}
+}
+
+func TestWatchedFileChangeUnopened(t *testing.T) {
+	changes := make(chan []protocol.FileEvent, 1)
+	editor, ws := newConnectedEditor(t, EditorConfig{}, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "workspace/didChangeWatchedFiles" {
+			var params protocol.DidChangeWatchedFilesParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			changes <- params.Changes
+		}
+		return reply(ctx, nil, nil)
+	})
+
+	ctx := context.Background()
+	// Watch Go files in the workspace, as gopls does.
+	if err := editor.client.RegisterCapability(ctx, &protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:     "1",
+			Method: "workspace/didChangeWatchedFiles",
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+				Watchers: []protocol.FileSystemWatcher{{
+					GlobPattern: protocol.GlobPattern{Value: path.Join(filepath.ToSlash(ws.Workdir.RootURI().Path()), "**/*.go")},
+				}},
+			},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither file is open: the change to main.go matches the registered
+	// pattern and must be delivered, while the change to notes.txt must not.
+	if err := ws.Workdir.WriteFiles(ctx, map[string]string{
+		"main.go":   "package main\n",
+		"notes.txt": "notes\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-changes:
+		want := []protocol.FileEvent{{URI: ws.Workdir.URI("main.go"), Type: protocol.Changed}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("didChangeWatchedFiles: unexpected changes (-want +got):\n%s", diff)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for didChangeWatchedFiles")
+	}
+}
+
+func TestConnectInitializeTimeout(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, nil)
+
+	// The server never responds to initialize, but keeps reading messages so
+	// that the client's cancellation notification can be delivered.
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "initialize" {
+			<-release
+		}
+		return reply(ctx, nil, nil)
+	}
+	ss := servertest.NewPipeServer(jsonrpc2.HandlerServer(jsonrpc2.AsyncHandler(handler)), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := editor.Connect(ctx, ss, ClientHooks{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Connect: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-editor.serverConn.Done():
+	case <-time.After(10 * time.Second):
+		t.Error("connection not closed after failed Connect")
+	}
+}
+
+func TestQuickFixDiagnosticData(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+
+	// The server publishes a diagnostic whose opaque data determines the
+	// title of the quick fix it later offers for that diagnostic.
+	uri := ws.Workdir.URI("main.go")
+	data := json.RawMessage(`{"fix":"use the data"}`)
+	var serverConn jsonrpc2.Conn
+	handler := func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		switch req.Method() {
+		case "initialize":
+			return reply(ctx, &protocol.InitializeResult{}, nil)
+		case "initialized":
+			return serverConn.Notify(ctx, "textDocument/publishDiagnostics", &protocol.PublishDiagnosticsParams{
+				URI:         uri,
+				Diagnostics: []protocol.Diagnostic{{Message: "needs a fix", Data: &data}},
+			})
+		case "textDocument/codeAction":
+			var params protocol.CodeActionParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			var actions []protocol.CodeAction
+			for _, diag := range params.Context.Diagnostics {
+				var fix struct{ Fix string }
+				if diag.Data == nil || json.Unmarshal(*diag.Data, &fix) != nil {
+					continue
+				}
+				actions = append(actions, protocol.CodeAction{Title: fix.Fix, Kind: protocol.QuickFix})
+			}
+			return reply(ctx, actions, nil)
+		}
+		return reply(ctx, nil, nil)
+	}
+	ss := servertest.NewPipeServer(jsonrpc2.ServerFunc(func(ctx context.Context, conn jsonrpc2.Conn) error {
+		serverConn = conn
+		return jsonrpc2.HandlerServer(handler).ServeStream(ctx, conn)
+	}), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := editor.Connect(ctx, ss, ClientHooks{}); err != nil {
+		t.Fatal(err)
+	}
+	defer editor.cancelConn()
+
+	var diags []protocol.Diagnostic
+	if err := editor.diagnostics.await(ctx, func() bool {
+		if params, ok := editor.diagnostics.latest[uri]; ok {
+			diags = params.Diagnostics
+			return true
+		}
+		return false
+	}); err != nil {
+		t.Fatalf("awaiting diagnostics: %v", err)
+	}
+	if len(diags) != 1 || diags[0].Data == nil || string(*diags[0].Data) != string(data) {
+		t.Fatalf("published diagnostics = %+v, want one with data %s", diags, data)
+	}
+	fixes, err := editor.GetQuickFixes(ctx, protocol.Location{URI: uri}, diags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixes) != 1 || fixes[0].Title != "use the data" {
+		t.Errorf("GetQuickFixes = %+v, want a single fix titled %q", fixes, "use the data")
+	}
+}
+
+// declarationServer is a stub server that responds to declaration requests
+// with a fixed result.
+type declarationServer struct {
+	stubServer
+	result *protocol.Or_textDocument_declaration
+}
+
+func (s *declarationServer) Declaration(context.Context, *protocol.DeclarationParams) (*protocol.Or_textDocument_declaration, error) {
+	return s.result, nil
+}
+
+func TestDeclarations(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("main.go", "Println")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := protocol.Location{URI: ws.Workdir.URI("main.go"), Range: protocol.Range{
+		Start: protocol.Position{Line: 2, Character: 8},
+		End:   protocol.Position{Line: 2, Character: 11},
+	}}
+	tests := []struct {
+		name   string
+		result *protocol.Or_textDocument_declaration
+		want   []protocol.Location
+	}{
+		{"no result", nil, nil},
+		{"locations", &protocol.Or_textDocument_declaration{Value: []protocol.Location{target}}, []protocol.Location{target}},
+		{"links", &protocol.Or_textDocument_declaration{Value: []protocol.DeclarationLink{{
+			TargetURI:            target.URI,
+			TargetRange:          protocol.Range{End: protocol.Position{Line: 3}},
+			TargetSelectionRange: target.Range,
+		}}}, []protocol.Location{target}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor.Server = &declarationServer{result: test.result}
+			got, err := editor.Declarations(ctx, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Declarations: unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// resolvingServer is a stub server that adds an import edit to completion
+// items when they are resolved.
+type resolvingServer struct {
+	stubServer
+}
+
+func (s *resolvingServer) ResolveCompletionItem(_ context.Context, item *protocol.CompletionItem) (*protocol.CompletionItem, error) {
+	resolved := *item
+	resolved.AdditionalTextEdits = []protocol.TextEdit{NewEdit(2, 0, 2, 0, "import \"os\"\n")}
+	return &resolved, nil
+}
+
+func TestAcceptCompletionResolve(t *testing.T) {
+	for _, resolve := range []bool{false, true} {
+		t.Run(fmt.Sprint("resolve=", resolve), func(t *testing.T) {
+			editor, _ := newTestEditor(t, exampleProgram, &resolvingServer{})
+			editor.config.ResolveCompletionBeforeAccept = resolve
+			ctx := context.Background()
+			if err := editor.OpenFile(ctx, "main.go"); err != nil {
+				t.Fatal(err)
+			}
+
+			loc, err := editor.RegexpSearch("main.go", `fmt\.(Println)`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := json.RawMessage(`{}`)
+			item := protocol.CompletionItem{
+				Label:    "Exit",
+				TextEdit: &protocol.Or_CompletionItem_textEdit{Value: protocol.TextEdit{Range: loc.Range, NewText: "Exit"}},
+				Data:     &data,
+			}
+			if err := editor.AcceptCompletion(ctx, loc, item); err != nil {
+				t.Fatal(err)
+			}
+			text, _ := editor.BufferText("main.go")
+			if !strings.Contains(text, "fmt.Exit") {
+				t.Errorf("completion was not applied:\n%s", text)
+			}
+			if got := strings.Contains(text, `import "os"`); got != resolve {
+				t.Errorf("import edit applied: got %t, want %t:\n%s", got, resolve, text)
+			}
+		})
+	}
+}
+
+// lensServer is a stub server that populates the command of code lenses on
+// resolution.
+type lensServer struct {
+	stubServer
+}
+
+func (s *lensServer) ResolveCodeLens(_ context.Context, lens *protocol.CodeLens) (*protocol.CodeLens, error) {
+	resolved := *lens
+	resolved.Command = &protocol.Command{Title: "run test", Command: "gopls.test"}
+	return &resolved, nil
+}
+
+func TestResolveCodeLens(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, &lensServer{})
+
+	lens := protocol.CodeLens{Range: protocol.Range{Start: protocol.Position{Line: 4}}}
+	resolved, err := editor.ResolveCodeLens(context.Background(), lens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Range != lens.Range || resolved.Command == nil || resolved.Command.Command != "gopls.test" {
+		t.Errorf("ResolveCodeLens(%+v) = %+v, want the lens with its gopls.test command", lens, resolved)
+	}
+}
+
+// quickFixServer is a stub server that responds to code action requests
+// with a fixed list of actions.
+type quickFixServer struct {
+	stubServer
+	actions []protocol.CodeAction
+}
+
+func (s *quickFixServer) CodeAction(context.Context, *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	return s.actions, nil
+}
+
+func TestPreferredQuickFix(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	loc := ws.Workdir.EntireFile("main.go")
+
+	fixAll := protocol.CodeAction{Title: "fix all", Kind: protocol.SourceFixAll, IsPreferred: true}
+	first := protocol.CodeAction{Title: "first", Kind: protocol.QuickFix}
+	preferred := protocol.CodeAction{Title: "preferred", Kind: protocol.QuickFix, IsPreferred: true}
+	tests := []struct {
+		name    string
+		actions []protocol.CodeAction
+		want    string
+	}{
+		{"preferred", []protocol.CodeAction{fixAll, first, preferred}, "preferred"},
+		{"none preferred", []protocol.CodeAction{fixAll, first}, "first"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor.Server = &quickFixServer{actions: test.actions}
+			got, err := editor.PreferredQuickFix(ctx, loc, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.want {
+				t.Errorf("PreferredQuickFix = %q, want %q", got.Title, test.want)
+			}
+		})
+	}
+
+	editor.Server = &quickFixServer{actions: []protocol.CodeAction{fixAll}}
+	if got, err := editor.PreferredQuickFix(ctx, loc, nil); err == nil {
+		t.Errorf("PreferredQuickFix with no quick fixes = %+v, want error", got)
+	}
+}
+
+// inlayHintServer is a stub server that adds a tooltip and label location to
+// inlay hints on resolution.
+type inlayHintServer struct {
+	stubServer
+	loc protocol.Location
+}
+
+func (s *inlayHintServer) Resolve(_ context.Context, hint *protocol.InlayHint) (*protocol.InlayHint, error) {
+	resolved := *hint
+	resolved.Label = []protocol.InlayHintLabelPart{{
+		Value:    hint.Label[0].Value,
+		Tooltip:  &protocol.OrPTooltipPLabel{Value: "a tooltip"},
+		Location: &s.loc,
+	}}
+	return &resolved, nil
+}
+
+func TestResolveInlayHint(t *testing.T) {
+	server := &inlayHintServer{}
+	editor, ws := newTestEditor(t, exampleProgram, server)
+	loc := ws.Workdir.EntireFile("main.go")
+	server.loc = loc
+
+	hint := protocol.InlayHint{Label: []protocol.InlayHintLabelPart{{Value: "int"}}}
+	resolved, err := editor.ResolveInlayHint(context.Background(), hint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved.Label) != 1 || resolved.Label[0].Tooltip == nil || resolved.Label[0].Location == nil || *resolved.Label[0].Location != loc {
+		t.Errorf("ResolveInlayHint(%+v) = %+v, want a label part with a tooltip and location", hint, resolved)
+	}
+}
+
+// rangeFormattingServer is a stub server that responds to range formatting
+// requests by replacing the requested range with a fixed string. If editor is
+// set, it also edits the buffer before responding, simulating a concurrent
+// change.
+type rangeFormattingServer struct {
+	stubServer
+	editor *Editor
+}
+
+func (s *rangeFormattingServer) RangeFormatting(ctx context.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	if s.editor != nil {
+		if err := s.editor.EditBuffer(ctx, "main.go", []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// edited\n")}); err != nil {
+			return nil, err
+		}
+	}
+	return []protocol.TextEdit{{Range: params.Range, NewText: `fmt.Println("formatted")`}}, nil
+}
+
+func TestFormatBufferRange(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, &rangeFormattingServer{})
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("main.go", `fmt.Println\(.*\)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := editor.FormatBufferRange(ctx, loc); err != nil {
+		t.Fatal(err)
+	}
+	want := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("formatted")
+}
+`
+	if got, _ := editor.BufferText("main.go"); got != want {
+		t.Errorf("after FormatBufferRange, got buffer:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Edits computed against a stale version of the buffer must be rejected.
+	editor.Server = &rangeFormattingServer{editor: editor}
+	if err := editor.FormatBufferRange(ctx, loc); err == nil {
+		t.Error("FormatBufferRange succeeded after a concurrent edit, want error")
+	}
+}
+
+// onTypeFormattingServer is a stub server that responds to on-type formatting
+// requests by inserting the trigger character at the requested position.
+type onTypeFormattingServer struct {
+	stubServer
+}
+
+func (s *onTypeFormattingServer) OnTypeFormatting(_ context.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
+	rng := protocol.Range{Start: params.Position, End: params.Position}
+	return []protocol.TextEdit{{Range: rng, NewText: params.Ch}}, nil
+}
+
+func TestOnTypeFormat(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, &onTypeFormattingServer{})
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("main.go", `func main\(\) ()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := editor.OnTypeFormat(ctx, loc, "}"); err == nil {
+		t.Error("OnTypeFormat succeeded without server support, want error")
+	}
+
+	editor.serverCapabilities.DocumentOnTypeFormattingProvider = &protocol.DocumentOnTypeFormattingOptions{
+		FirstTriggerCharacter: "}",
+		MoreTriggerCharacter:  []string{";"},
+	}
+	if err := editor.OnTypeFormat(ctx, loc, "\n"); err == nil {
+		t.Error("OnTypeFormat succeeded for an unregistered trigger character, want error")
+	}
+	if err := editor.OnTypeFormat(ctx, loc, ";"); err != nil {
+		t.Fatal(err)
+	}
+	want := "func main() ;{"
+	if got, _ := editor.BufferText("main.go"); !strings.Contains(got, want) {
+		t.Errorf("after OnTypeFormat, got buffer:\n%s\nwant it to contain %q", got, want)
+	}
+}
+
+// willSaveServer is a stub server that responds to willSaveWaitUntil
+// requests with an edit inserting a comment at the start of the file.
+type willSaveServer struct {
+	stubServer
+	waitUntilCalls int
+}
+
+func (s *willSaveServer) WillSaveWaitUntil(context.Context, *protocol.WillSaveTextDocumentParams) ([]protocol.TextEdit, error) {
+	s.waitUntilCalls++
+	return []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// saved\n")}, nil
+}
+
+func TestSaveBufferWillSaveWaitUntil(t *testing.T) {
+	server := &willSaveServer{}
+	editor, ws := newTestEditor(t, exampleProgram, server)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the capability, willSaveWaitUntil must not be sent.
+	if err := editor.SaveBufferWithoutActions(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if server.waitUntilCalls != 0 {
+		t.Errorf("got %d willSaveWaitUntil requests without server support, want 0", server.waitUntilCalls)
+	}
+
+	editor.serverCapabilities.TextDocumentSync = &protocol.TextDocumentSyncOptions{WillSaveWaitUntil: true}
+	if err := editor.SaveBufferWithoutActions(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if server.waitUntilCalls != 1 {
+		t.Errorf("got %d willSaveWaitUntil requests, want 1", server.waitUntilCalls)
+	}
+	got, err := ws.Workdir.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// saved\npackage main\n"; !strings.HasPrefix(string(got), want) {
+		t.Errorf("saved file:\n%s\nwant prefix %q", got, want)
+	}
+	if editor.buffers["main.go"].dirty {
+		t.Error("buffer is dirty after save")
+	}
+}
+
+const multiFileProgram = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package p
+
+const A = 1
+-- b.go --
+package p
+
+const B = 2
+-- c.go --
+package p
+
+const C = 3
+`
+
+func TestEditBuffers(t *testing.T) {
+	editor, _ := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	for _, path := range []string{"b.go", "c.go"} {
+		if err := editor.OpenFile(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An invalid edit to one buffer must leave all buffers unchanged.
+	err := editor.EditBuffers(ctx, map[string][]protocol.TextEdit{
+		"b.go": {NewEdit(2, 10, 2, 11, "20")},
+		"c.go": {NewEdit(20, 0, 20, 0, "invalid")},
+	})
+	if err == nil {
+		t.Fatal("EditBuffers with an invalid edit succeeded")
+	}
+	for path, want := range map[string]int{"b.go": 1, "c.go": 1} {
+		if got := editor.BufferVersion(path); got != want {
+			t.Errorf("after failed EditBuffers, version of %s = %d, want %d", path, got, want)
+		}
+	}
+
+	if err := editor.EditBuffers(ctx, map[string][]protocol.TextEdit{
+		"b.go": {NewEdit(2, 10, 2, 11, "20")},
+		"c.go": {NewEdit(2, 10, 2, 11, "30")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"b.go": "const B = 20", "c.go": "const C = 30"} {
+		if got, _ := editor.BufferText(path); !strings.Contains(got, want) {
+			t.Errorf("after EditBuffers, %s = %q, want it to contain %q", path, got, want)
+		}
+	}
+}
+
+func TestApplyWorkspaceEditRenameAndEdits(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	for _, path := range []string{"b.go", "c.go"} {
+		if err := editor.OpenFile(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	textEdit := func(path, newText string) protocol.DocumentChange {
+		return protocol.DocumentChange{TextDocumentEdit: &protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				Version:                1,
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: ws.Workdir.URI(path)},
+			},
+			Edits: protocol.AsAnnotatedTextEdits([]protocol.TextEdit{NewEdit(2, 10, 2, 11, newText)}),
+		}}
+	}
+	wsedit := protocol.NewWorkspaceEdit(
+		protocol.DocumentChangeRename(ws.Workdir.URI("a.go"), ws.Workdir.URI("d.go")),
+		textEdit("b.go", "20"),
+		textEdit("c.go", "30"),
+	)
+	if err := editor.applyWorkspaceEdit(ctx, wsedit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ws.Workdir.ReadFile("a.go"); err == nil {
+		t.Error("a.go still exists after rename")
+	}
+	if _, err := ws.Workdir.ReadFile("d.go"); err != nil {
+		t.Errorf("reading renamed file: %v", err)
+	}
+	// Changes following the rename must not be dropped.
+	for path, want := range map[string]string{"b.go": "const B = 20", "c.go": "const C = 30"} {
+		if got, _ := editor.BufferText(path); !strings.Contains(got, want) {
+			t.Errorf("after applying workspace edit, %s = %q, want it to contain %q", path, got, want)
+		}
+	}
+}
+
+// configServer is a stub server that records didChangeConfiguration
+// notifications.
+type configServer struct {
+	stubServer
+	params []*protocol.DidChangeConfigurationParams
+}
+
+func (s *configServer) DidChangeConfiguration(_ context.Context, params *protocol.DidChangeConfigurationParams) error {
+	s.params = append(s.params, params)
+	return nil
+}
+
+func TestPushConfiguration(t *testing.T) {
+	server := &configServer{}
+	editor, _ := newTestEditor(t, exampleProgram, server)
+	ctx := context.Background()
+
+	config := editor.Config()
+	config.Settings = map[string]any{"staticcheck": true}
+	if err := editor.ChangeConfiguration(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	config.PushConfiguration = true
+	if err := editor.ChangeConfiguration(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.params) != 2 {
+		t.Fatalf("got %d didChangeConfiguration notifications, want 2", len(server.params))
+	}
+	if got := server.params[0].Settings; got != nil {
+		t.Errorf("without PushConfiguration, got settings %v, want none", got)
+	}
+	settings, ok := server.params[1].Settings.(map[string]any)
+	if !ok || settings["staticcheck"] != true || settings["env"] == nil {
+		t.Errorf("with PushConfiguration, got settings %v, want the editor settings", server.params[1].Settings)
+	}
+}
+
+func TestOpenFileRawBOM(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	const content = "\ufeffpackage bom\r\n\r\nconst C = 1\r\n"
+	if err := editor.OpenFileRaw(ctx, "bom.go", content); err != nil {
+		t.Fatal(err)
+	}
+
+	// The byte order mark is part of the buffer, and is its first character.
+	if got, _ := editor.BufferText("bom.go"); got != content {
+		t.Errorf("BufferText = %q, want %q", got, content)
+	}
+	loc, err := editor.RegexpSearch("bom.go", "package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (protocol.Position{Line: 0, Character: 1}); loc.Range.Start != want {
+		t.Errorf("RegexpSearch: got %v, want %v", loc.Range.Start, want)
+	}
+	loc, err = editor.RegexpSearch("bom.go", "C = (1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (protocol.Position{Line: 2, Character: 10}); loc.Range.Start != want {
+		t.Errorf("RegexpSearch: got %v, want %v", loc.Range.Start, want)
+	}
+
+	// It is preserved on save, as are line endings.
+	if err := editor.EditBuffer(ctx, "bom.go", []protocol.TextEdit{{Range: loc.Range, NewText: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.SaveBufferWithoutActions(ctx, "bom.go"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ws.Workdir.ReadFile("bom.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\ufeffpackage bom\r\n\r\nconst C = 2\r\n"; string(got) != want {
+		t.Errorf("saved file = %q, want %q", got, want)
+	}
+}
+
+func TestReadOnlyBuffer(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+
+	// Simulate a dependency in the module cache, which is outside the
+	// workspace root.
+	dep := filepath.ToSlash(filepath.Join(ws.GOPATH(), "pkg", "mod", "example.com", "dep@v1.0.0", "dep.go"))
+	const depContent = "package dep\n"
+	if err := ws.Workdir.WriteFile(ctx, dep, depContent); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.OpenFile(ctx, dep); err != nil {
+		t.Fatal(err)
+	}
+	edit := []protocol.TextEdit{NewEdit(0, 8, 0, 11, "foo")}
+	if err := editor.EditBuffer(ctx, dep, edit); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("EditBuffer(%s) = %v, want ErrReadOnly", dep, err)
+	}
+	if err := editor.SetBufferContent(ctx, dep, "package foo\n"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetBufferContent(%s) = %v, want ErrReadOnly", dep, err)
+	}
+	if got, _ := editor.BufferText(dep); got != depContent {
+		t.Errorf("read-only buffer was modified: got %q, want %q", got, depContent)
+	}
+
+	// Workspace buffers remain editable.
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.EditBuffer(ctx, "main.go", edit); err != nil {
+		t.Errorf("EditBuffer(main.go) failed: %v", err)
+	}
+}
+
+func TestOpenFileReadOnly(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+
+	if err := editor.OpenFileReadOnly(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := editor.BufferText("main.go")
+	edit := []protocol.TextEdit{NewEdit(0, 8, 0, 12, "foo")}
+	if err := editor.EditBuffer(ctx, "main.go", edit); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("EditBuffer(main.go) = %v, want ErrReadOnly", err)
+	}
+	// Edits requested by the server are rejected too.
+	wsedit := &protocol.WorkspaceEdit{
+		DocumentChanges: []protocol.DocumentChange{{
+			TextDocumentEdit: &protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					Version:                1,
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: ws.Workdir.URI("main.go")},
+				},
+				Edits: protocol.AsAnnotatedTextEdits(edit),
+			},
+		}},
+	}
+	if err := editor.applyWorkspaceEdit(ctx, wsedit); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("applyWorkspaceEdit(main.go) = %v, want ErrReadOnly", err)
+	}
+	if got, _ := editor.BufferText("main.go"); got != want {
+		t.Errorf("read-only buffer was modified: got %q, want %q", got, want)
+	}
+	if got := editor.BufferVersion("main.go"); got != 1 {
+		t.Errorf("read-only buffer version = %d, want 1", got)
+	}
+	if err := editor.OpenFileReadOnly(ctx, "main.go"); err == nil {
+		t.Error("OpenFileReadOnly succeeded for an open buffer")
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	// The server records the ID of the completion request, and that of any
+	// request it is asked to cancel.
+	completionID := make(chan jsonrpc2.ID, 1)
+	cancelledID := make(chan jsonrpc2.ID, 1)
+	editor, _ := newConnectedEditor(t, EditorConfig{}, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		switch req.Method() {
+		case "textDocument/completion":
+			completionID <- req.(*jsonrpc2.Call).ID()
+			return nil // never reply
+		case "$/cancelRequest":
+			var params protocol.CancelParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				t.Error(err)
+			}
+			var id jsonrpc2.ID
+			switch raw := params.ID.(type) {
+			case float64:
+				id = jsonrpc2.NewIntID(int64(raw))
+			case string:
+				id = jsonrpc2.NewStringID(raw)
+			}
+			cancelledID <- id
+		}
+		return reply(ctx, nil, nil)
+	})
+	loc := openPrintln(t, editor)
+
+	callCtx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := editor.Completion(callCtx, loc)
+		errc <- err
+	}()
+	id := <-completionID
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Completion: got error %v, want context.Canceled", err)
+	}
+	select {
+	case got := <-cancelledID:
+		if got != id {
+			t.Errorf("$/cancelRequest for request %v, want %v", got, id)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not receive $/cancelRequest")
+	}
+}
+
+// saveActionsServer is a stub server that offers the given code actions, and
+// responds to formatting requests with no edits. If editor is set, it also
+// edits the buffer before responding, simulating a concurrent change.
+type saveActionsServer struct {
+	stubServer
+	editor  *Editor
+	actions []protocol.CodeAction
+}
+
+func (s *saveActionsServer) CodeAction(context.Context, *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	return s.actions, nil
+}
+
+func (s *saveActionsServer) Formatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	if s.editor != nil {
+		if err := s.editor.EditBuffer(ctx, "main.go", []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// concurrent\n")}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func TestEditAndSaveVersionChanged(t *testing.T) {
+	editor, ws := newTestEditor(t, exampleProgram, &saveActionsServer{})
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := editor.EditAndSave(ctx, "main.go", []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// first\n")}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ws.Workdir.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := editor.BufferText("main.go"); string(saved) != got || !strings.HasPrefix(got, "// first\n") {
+		t.Fatalf("after EditAndSave, file contains:\n%s\nbuffer contains:\n%s", saved, got)
+	}
+
+	// A change between the edit and the save must be detected, and the file
+	// left unchanged.
+	editor.Server = &saveActionsServer{editor: editor}
+	err = editor.EditAndSave(ctx, "main.go", []protocol.TextEdit{NewEdit(0, 0, 0, 0, "// second\n")})
+	if !errors.Is(err, ErrVersionChanged) {
+		t.Errorf("EditAndSave with a concurrent edit: got error %v, want ErrVersionChanged", err)
+	}
+	if got, err := ws.Workdir.ReadFile("main.go"); err != nil || string(got) != string(saved) {
+		t.Errorf("EditAndSave with a concurrent edit modified the file:\n%s", got)
+	}
+}
+
+func TestSaveUntitledCodeAction(t *testing.T) {
+	server := &saveActionsServer{
+		actions: []protocol.CodeAction{{Kind: protocol.SourceOrganizeImports}},
+	}
+	editor, _ := newTestEditor(t, exampleProgram, server)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.SaveBuffer(ctx, "main.go"); err == nil || !strings.Contains(err.Error(), "empty title") {
+		t.Errorf("SaveBuffer: got error %v, want an empty title error", err)
+	}
+	if err := editor.EditAndSave(ctx, "main.go", nil); err == nil || !strings.Contains(err.Error(), "empty title") {
+		t.Errorf("EditAndSave: got error %v, want an empty title error", err)
+	}
+}
+
+func TestClientApplyEdit(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	client := &Client{editor: editor}
+	for _, path := range []string{"a.go", "b.go"} {
+		if err := editor.OpenFile(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	textEdit := func(path string, version int, newText string) protocol.DocumentChange {
+		return protocol.DocumentChange{TextDocumentEdit: &protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				Version:                int32(version),
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: ws.Workdir.URI(path)},
+			},
+			Edits: []protocol.Or_TextDocumentEdit_edits_Elem{{Value: NewEdit(0, 0, 0, 0, newText)}},
+		}}
+	}
+
+	res, err := client.ApplyEdit(ctx, &protocol.ApplyWorkspaceEditParams{
+		Edit: protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{
+			textEdit("a.go", editor.BufferVersion("a.go"), "// a\n"),
+		}},
+	})
+	if err != nil || !res.Applied {
+		t.Fatalf("ApplyEdit = %+v, %v, want applied", res, err)
+	}
+
+	// The second change is for a stale version of b.go, so is not applied.
+	res, err = client.ApplyEdit(ctx, &protocol.ApplyWorkspaceEditParams{
+		Edit: protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{
+			textEdit("a.go", editor.BufferVersion("a.go"), "// again\n"),
+			textEdit("b.go", editor.BufferVersion("b.go")-1, "// b\n"),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Applied || res.FailedChange != 1 || !strings.Contains(res.FailureReason, "do not match") {
+		t.Errorf("ApplyEdit with a stale version = %+v, want failure of change 1 with a version mismatch", res)
+	}
+	if got, _ := editor.BufferText("a.go"); !strings.HasPrefix(got, "// again\n// a\n") {
+		t.Errorf("a.go = %q, want both edits applied", got)
+	}
+	if got, _ := editor.BufferText("b.go"); strings.HasPrefix(got, "// b\n") {
+		t.Errorf("b.go = %q, want the stale edit not applied", got)
+	}
+}
+
+func TestDynamicRegistration(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	client := &Client{editor: editor}
+
+	const method = "workspace/didChangeWatchedFiles"
+	watch := func(id, pattern string) protocol.Registration {
+		return protocol.Registration{
+			ID:     id,
+			Method: method,
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+				Watchers: []protocol.FileSystemWatcher{{GlobPattern: protocol.GlobPattern{Value: pattern}}},
+			},
+		}
+	}
+	watched := func(filename string) bool {
+		editor.mu.Lock()
+		defer editor.mu.Unlock()
+		for _, g := range editor.watchPatterns {
+			if g.Match(filename) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if editor.IsRegistered(method) {
+		t.Fatalf("%s is registered initially", method)
+	}
+	// As gopls does, register new watchers before unregistering the old.
+	if err := client.RegisterCapability(ctx, &protocol.RegistrationParams{
+		Registrations: []protocol.Registration{watch("1", "/a/**/*.go")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RegisterCapability(ctx, &protocol.RegistrationParams{
+		Registrations: []protocol.Registration{watch("2", "/b/**/*.go")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !editor.IsRegistered(method) || !watched("/a/a.go") || !watched("/b/b.go") {
+		t.Errorf("after registering watchers for a and b, got IsRegistered %t, a watched %t, b watched %t", editor.IsRegistered(method), watched("/a/a.go"), watched("/b/b.go"))
+	}
+	if err := client.RegisterCapability(ctx, &protocol.RegistrationParams{
+		Registrations: []protocol.Registration{watch("2", "/c/**/*.go")},
+	}); err == nil {
+		t.Error("RegisterCapability with a duplicate ID succeeded")
+	}
+
+	if err := client.UnregisterCapability(ctx, &protocol.UnregistrationParams{
+		Unregisterations: []protocol.Unregistration{{ID: "1", Method: method}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !editor.IsRegistered(method) || watched("/a/a.go") || !watched("/b/b.go") {
+		t.Errorf("after unregistering watchers for a, got IsRegistered %t, a watched %t, b watched %t", editor.IsRegistered(method), watched("/a/a.go"), watched("/b/b.go"))
+	}
+	if err := client.UnregisterCapability(ctx, &protocol.UnregistrationParams{
+		Unregisterations: []protocol.Unregistration{{ID: "2", Method: method}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if editor.IsRegistered(method) || watched("/b/b.go") {
+		t.Errorf("after unregistering all watchers, got IsRegistered %t, b watched %t", editor.IsRegistered(method), watched("/b/b.go"))
+	}
+	if err := client.UnregisterCapability(ctx, &protocol.UnregistrationParams{
+		Unregisterations: []protocol.Unregistration{{ID: "2", Method: method}},
+	}); err == nil {
+		t.Error("UnregisterCapability of an unknown registration succeeded")
+	}
+}
+
+// fileOperationsServer is a stub server that records the file operation
+// notifications it receives.
+type fileOperationsServer struct {
+	stubServer
+	renamed []protocol.FileRename
+	deleted []protocol.FileDelete
+}
+
+func (s *fileOperationsServer) DidRenameFiles(_ context.Context, params *protocol.RenameFilesParams) error {
+	s.renamed = append(s.renamed, params.Files...)
+	return nil
+}
+
+func (s *fileOperationsServer) DidDeleteFiles(_ context.Context, params *protocol.DeleteFilesParams) error {
+	s.deleted = append(s.deleted, params.Files...)
+	return nil
+}
+
+func TestFileOperationNotifications(t *testing.T) {
+	server := &fileOperationsServer{}
+	editor, ws := newTestEditor(t, multiFileProgram, server)
+	ctx := context.Background()
+
+	// Without the server capability, no notifications are sent.
+	if err := editor.RenameFile(ctx, "a.go", "a2.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.DidDeleteFiles(ctx, ws.Workdir.URI("b.go")); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.renamed) > 0 || len(server.deleted) > 0 {
+		t.Fatalf("got notifications %v, %v without server capability", server.renamed, server.deleted)
+	}
+
+	editor.serverCapabilities.Workspace = &protocol.WorkspaceOptions{
+		FileOperations: &protocol.FileOperationOptions{
+			DidRename: &protocol.FileOperationRegistrationOptions{},
+			DidDelete: &protocol.FileOperationRegistrationOptions{},
+		},
+	}
+	if err := editor.RenameFile(ctx, "a2.go", "a3.go"); err != nil {
+		t.Fatal(err)
+	}
+	wantRename := protocol.FileRename{OldURI: string(ws.Workdir.URI("a2.go")), NewURI: string(ws.Workdir.URI("a3.go"))}
+	if len(server.renamed) != 1 || server.renamed[0] != wantRename {
+		t.Errorf("after RenameFile, got didRenameFiles %v, want %v", server.renamed, wantRename)
+	}
+	if err := editor.DidDeleteFiles(ctx, ws.Workdir.URI("b.go")); err != nil {
+		t.Fatal(err)
+	}
+	wantDelete := protocol.FileDelete{URI: string(ws.Workdir.URI("b.go"))}
+	if len(server.deleted) != 1 || server.deleted[0] != wantDelete {
+		t.Errorf("got didDeleteFiles %v, want %v", server.deleted, wantDelete)
+	}
+	if stats := editor.Stats(); stats.DidRenameFiles != 1 || stats.DidDeleteFiles != 1 {
+		t.Errorf("got %d didRenameFiles and %d didDeleteFiles calls, want 1 of each", stats.DidRenameFiles, stats.DidDeleteFiles)
+	}
+}
+
+// callCountsServer is a stub server that accepts the notifications counted
+// by CallCounts.
+type callCountsServer struct {
+	stubServer
+}
+
+func (callCountsServer) DidCreateFiles(context.Context, *protocol.CreateFilesParams) error {
+	return nil
+}
+
+func (callCountsServer) DidChangeWorkspaceFolders(context.Context, *protocol.DidChangeWorkspaceFoldersParams) error {
+	return nil
+}
+
+func TestCallCounts(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, callCountsServer{})
+	ctx := context.Background()
+	editor.serverCapabilities.Workspace = &protocol.WorkspaceOptions{
+		FileOperations: &protocol.FileOperationOptions{
+			DidCreate: &protocol.FileOperationRegistrationOptions{},
+		},
+	}
+
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.SaveBufferWithoutActions(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	create := protocol.DocumentChange{CreateFile: &protocol.CreateFile{Kind: "create", URI: ws.Workdir.URI("d.go")}}
+	if err := editor.applyWorkspaceEdit(ctx, &protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{create}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.ChangeWorkspaceFolders(ctx, []string{"."}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := CallCounts{
+		DidOpen:                   2, // a.go and the created d.go
+		WillSave:                  1,
+		DidSave:                   1,
+		DidCreateFiles:            1,
+		DidChangeWorkspaceFolders: 1,
+	}
+	if got := editor.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAwaitProgress(t *testing.T) {
+	ctx := context.Background()
+	editor := NewEditor(nil, EditorConfig{})
+	client := &Client{editor: editor}
+	progress := func(token, kind, title string) {
+		t.Helper()
+		params := &protocol.ProgressParams{
+			Token: token,
+			Value: map[string]any{"kind": kind, "title": title},
+		}
+		if err := client.Progress(ctx, params); err != nil {
+			t.Error(err) // may be called from another goroutine
+		}
+	}
+
+	// Work that ended before the call is ignored.
+	progress("1", "begin", "diagnosing changed files")
+	progress("1", "end", "")
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := editor.AwaitProgress(timeoutCtx, "^diagnosing"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AwaitProgress for ended work returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Work in progress counts once it ends, but only if its title matches.
+	progress("2", "begin", "diagnosing saved files")
+	progress("3", "begin", "Running go test")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		progress("3", "end", "")
+		progress("2", "end", "")
+	}()
+	if err := editor.AwaitProgress(ctx, "^diagnosing"); err != nil {
+		t.Fatal(err)
+	}
+	editor.progress.mu.Lock()
+	ended := editor.progress.ended["2"]
+	editor.progress.mu.Unlock()
+	if !ended {
+		t.Error("AwaitProgress returned before the matching work ended")
+	}
+
+	if err := editor.AwaitProgress(ctx, "("); err == nil {
+		t.Error("AwaitProgress with an invalid pattern succeeded")
+	}
+}
+
+func TestMalformedProgress(t *testing.T) {
+	ctx := context.Background()
+	editor := NewEditor(nil, EditorConfig{})
+	var delivered int
+	client := &Client{editor: editor, hooks: ClientHooks{
+		OnProgress: func(context.Context, *protocol.ProgressParams) error {
+			delivered++
+			return nil
+		},
+	}}
+
+	// A value that cannot be read still reaches the hook, but fails awaits.
+	if err := client.Progress(ctx, &protocol.ProgressParams{Token: "1", Value: "begin"}); err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 {
+		t.Errorf("OnProgress called %d times, want 1", delivered)
+	}
+	if err := editor.AwaitProgress(ctx, ".*"); err == nil {
+		t.Error("AwaitProgress after a malformed progress value succeeded")
+	}
+}
+
+// streamingReferencesServer is a stub server that streams its references
+// results as partial results through the client.
+type streamingReferencesServer struct {
+	stubServer
+	client *Client
+	chunks [][]protocol.Location
+	last   []protocol.Location // returned in the response
+}
+
+func (s *streamingReferencesServer) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
+	if params.PartialResultToken == nil {
+		return nil, fmt.Errorf("missing partial result token")
+	}
+	for _, chunk := range s.chunks {
+		if err := s.client.Progress(ctx, &protocol.ProgressParams{Token: *params.PartialResultToken, Value: chunk}); err != nil {
+			return nil, err
+		}
+	}
+	return s.last, nil
+}
+
+func TestReferencesStreaming(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc := func(path string, line uint32) protocol.Location {
+		return protocol.Location{URI: ws.Workdir.URI(path), Range: protocol.Range{Start: protocol.Position{Line: line}, End: protocol.Position{Line: line}}}
+	}
+	// Partial results reach the client's progress hook, like any other
+	// $/progress notification.
+	var notified int
+	client := &Client{editor: editor, hooks: ClientHooks{
+		OnProgress: func(context.Context, *protocol.ProgressParams) error {
+			notified++
+			return nil
+		},
+	}}
+	server := &streamingReferencesServer{
+		client: client,
+		chunks: [][]protocol.Location{
+			{loc("a.go", 1), loc("a.go", 2)},
+			{loc("b.go", 3)},
+		},
+		last: []protocol.Location{loc("c.go", 4)},
+	}
+	editor.Server = server
+
+	var got [][]protocol.Location
+	if err := editor.ReferencesStreaming(ctx, loc("a.go", 0), func(chunk []protocol.Location) {
+		got = append(got, chunk)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := append(server.chunks, server.last)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("streamed chunks mismatch (-want +got):\n%s", diff)
+	}
+	if len(editor.progress.partial) != 0 {
+		t.Errorf("partial result token still registered after the request")
+	}
+	if notified != len(server.chunks) {
+		t.Errorf("OnProgress called %d times, want %d", notified, len(server.chunks))
+	}
+}
+
+func TestRegexpReplaceAll(t *testing.T) {
+	editor, _ := newTestEditor(t, exampleProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+	version := editor.BufferVersion("main.go")
+	if err := editor.RegexpReplaceAll(ctx, "main.go", `(main)\b`, "other"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := editor.BufferText("main.go")
+	want := strings.ReplaceAll(string(UnpackTxt(exampleProgram)["main.go"]), "main", "other")
+	if got != want {
+		t.Errorf("after RegexpReplaceAll, got buffer:\n%s\nwant:\n%s", got, want)
+	}
+	if v := editor.BufferVersion("main.go"); v != version+1 {
+		t.Errorf("RegexpReplaceAll changed the buffer version from %d to %d, want a single change", version, v)
+	}
+	if changes := editor.LastContentChanges("main.go"); len(changes) != 1 {
+		t.Errorf("RegexpReplaceAll sent content changes %v, want a single full change", changes)
+	}
+
+	if err := editor.RegexpReplaceAll(ctx, "main.go", "main", "x"); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("RegexpReplaceAll with no match returned %v, want %v", err, ErrNoMatch)
+	}
+	if err := editor.RegexpReplaceAll(ctx, "main.go", "(o)(t)", "x"); err == nil {
+		t.Error("RegexpReplaceAll with two subgroups succeeded unexpectedly")
+	}
+}
+
+func TestAppliedAnnotations(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	id := protocol.ChangeAnnotationIdentifier("confirm")
+	wsedit := &protocol.WorkspaceEdit{
+		DocumentChanges: []protocol.DocumentChange{{TextDocumentEdit: &protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				Version:                int32(editor.BufferVersion("a.go")),
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: ws.Workdir.URI("a.go")},
+			},
+			Edits: []protocol.Or_TextDocumentEdit_edits_Elem{
+				{Value: NewEdit(0, 0, 0, 0, "// plain\n")},
+				{Value: protocol.AnnotatedTextEdit{
+					AnnotationID: &id,
+					TextEdit:     NewEdit(1, 0, 1, 0, "// annotated\n"),
+				}},
+			},
+		}}},
+		ChangeAnnotations: map[protocol.ChangeAnnotationIdentifier]protocol.ChangeAnnotation{
+			id: {Label: "Needs confirmation", NeedsConfirmation: true},
+		},
+	}
+	// Round trip the edit through JSON, as it would be received from a server.
+	wsedit, err := marshalUnmarshal[*protocol.WorkspaceEdit](wsedit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := editor.applyWorkspaceEdit(ctx, wsedit); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := editor.BufferText("a.go"); !strings.HasPrefix(got, "// plain\npackage p\n// annotated\n") {
+		t.Errorf("a.go = %q, want both edits applied", got)
+	}
+	if diff := cmp.Diff([]protocol.ChangeAnnotationIdentifier{id}, editor.AppliedAnnotations()); diff != "" {
+		t.Errorf("AppliedAnnotations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResourceOperations(t *testing.T) {
+	capabilities, err := clientCapabilities(EditorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []protocol.ResourceOperationKind{"create", "rename", "delete"} {
+		if !slices.Contains(capabilities.Workspace.WorkspaceEdit.ResourceOperations, kind) {
+			t.Errorf("client capabilities do not include the %q resource operation", kind)
+		}
+	}
+
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	ctx := context.Background()
+	wsedit := &protocol.WorkspaceEdit{
+		DocumentChanges: []protocol.DocumentChange{
+			protocol.DocumentChangeCreate(ws.Workdir.URI("d.go")),
+			{DeleteFile: &protocol.DeleteFile{Kind: "delete", URI: ws.Workdir.URI("c.go")}},
+		},
+	}
+	if err := editor.applyWorkspaceEdit(ctx, wsedit); err != nil {
+		t.Fatal(err)
+	}
+	if !editor.HasBuffer("d.go") {
+		t.Error("workspace edit did not create a buffer for d.go")
+	}
+	if _, err := ws.Workdir.ReadFile("c.go"); !os.IsNotExist(err) {
+		t.Errorf("after deleting c.go, ReadFile returned %v, want a not-exist error", err)
+	}
+	if _, err := ws.Workdir.ReadFile("b.go"); err != nil {
+		t.Errorf("deleting c.go affected b.go: %v", err)
+	}
+}
+
+// Test that a workspace edit deleting a file closes its buffer.
+func TestDeleteOpenFile(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, callCountsServer{})
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	wsedit := &protocol.WorkspaceEdit{
+		DocumentChanges: []protocol.DocumentChange{
+			{DeleteFile: &protocol.DeleteFile{Kind: "delete", URI: ws.Workdir.URI("a.go")}},
+		},
+	}
+	if err := editor.applyWorkspaceEdit(ctx, wsedit); err != nil {
+		t.Fatal(err)
+	}
+	if editor.HasBuffer("a.go") {
+		t.Error("a.go is still open after it was deleted")
+	}
+	if got := editor.Stats().DidClose; got != 1 {
+		t.Errorf("got %d didClose notifications, want 1", got)
+	}
+	if _, err := ws.Workdir.ReadFile("a.go"); !os.IsNotExist(err) {
+		t.Errorf("after deleting a.go, ReadFile returned %v, want a not-exist error", err)
+	}
+}
+
+// generateTestServer is a stub server that offers a fixed list of code
+// actions, and resolves the edit of a source.addTest action to resolved.
+type generateTestServer struct {
+	stubServer
+	actions  []protocol.CodeAction
+	resolved *protocol.WorkspaceEdit
+}
+
+func (s *generateTestServer) CodeAction(context.Context, *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	return s.actions, nil
+}
+
+func (s *generateTestServer) ResolveCodeAction(_ context.Context, action *protocol.CodeAction) (*protocol.CodeAction, error) {
+	resolved := *action
+	if action.Kind == addTestKind {
+		resolved.Edit = s.resolved
+	}
+	return &resolved, nil
+}
+
+func TestGenerateTest(t *testing.T) {
+	editor, ws := newTestEditor(t, multiFileProgram, nil)
+	editor.config.CapabilitiesJSON = []byte(`{"textDocument": {"codeAction": {"resolveSupport": {"properties": ["edit"]}}}}`)
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("a.go", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// createTest returns an edit that creates a_test.go with the given content.
+	createTest := func(content string) *protocol.WorkspaceEdit {
+		uri := ws.Workdir.URI("a_test.go")
+		return protocol.NewWorkspaceEdit(
+			protocol.DocumentChangeCreate(uri),
+			protocol.DocumentChange{TextDocumentEdit: &protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					Version:                1, // the version of the created buffer
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				},
+				Edits: protocol.AsAnnotatedTextEdits([]protocol.TextEdit{NewEdit(0, 0, 0, 0, content)}),
+			}},
+		)
+	}
+	inline := protocol.CodeAction{
+		Title: "Inline constant",
+		Kind:  protocol.RefactorRewrite,
+		Edit: protocol.NewWorkspaceEdit(protocol.DocumentChange{TextDocumentEdit: &protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				Version:                1,
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: loc.URI},
+			},
+			Edits: protocol.AsAnnotatedTextEdits([]protocol.TextEdit{{Range: loc.Range, NewText: "inlined"}}),
+		}}),
+	}
+	const (
+		addTestContent = "package p // from source.addTest\n"
+		rewriteContent = "package p // from refactor.rewrite\n"
+	)
+	tests := []struct {
+		name   string
+		server *generateTestServer
+		want   string // content of a_test.go, or "" if GenerateTest fails
+	}{
+		{
+			"source.addTest",
+			&generateTestServer{
+				actions:  []protocol.CodeAction{inline, {Title: "Add test for A", Kind: addTestKind}},
+				resolved: createTest(addTestContent),
+			},
+			addTestContent,
+		},
+		{
+			"refactor.rewrite",
+			&generateTestServer{
+				actions: []protocol.CodeAction{inline, {Title: "Add test", Kind: protocol.RefactorRewrite, Edit: createTest(rewriteContent)}},
+			},
+			rewriteContent,
+		},
+		{
+			"no test action",
+			&generateTestServer{actions: []protocol.CodeAction{inline}},
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor.Server = test.server
+			defer func() {
+				if editor.HasBuffer("a_test.go") {
+					if err := editor.CloseBuffer(ctx, "a_test.go"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}()
+
+			err := editor.GenerateTest(ctx, loc)
+			if test.want == "" {
+				if err == nil {
+					t.Fatal("GenerateTest succeeded without a test action")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := editor.BufferText("a_test.go"); got != test.want {
+				t.Errorf("after GenerateTest, a_test.go = %q, want %q", got, test.want)
+			}
+			if got, _ := editor.BufferText("a.go"); strings.Contains(got, "inlined") {
+				t.Errorf("GenerateTest applied the unrelated %q action", inline.Title)
+			}
+		})
+	}
+}
+
+// colorServer is a stub server that reports the string literal "red" as a
+// color reference, and presents colors by their RGB components.
+type colorServer struct {
+	stubServer
+	editor *Editor
+}
+
+var red = protocol.Color{Red: 1, Alpha: 1}
+
+func (s *colorServer) DocumentColor(_ context.Context, params *protocol.DocumentColorParams) ([]protocol.ColorInformation, error) {
+	path := s.editor.sandbox.Workdir.URIToPath(params.TextDocument.URI)
+	loc, err := s.editor.RegexpSearch(path, `"(red)"`)
+	if err != nil {
+		return nil, err
+	}
+	return []protocol.ColorInformation{{Range: loc.Range, Color: red}}, nil
+}
+
+func (s *colorServer) ColorPresentation(_ context.Context, params *protocol.ColorPresentationParams) ([]protocol.ColorPresentation, error) {
+	c := params.Color
+	label := fmt.Sprintf("rgb(%g, %g, %g)", c.Red, c.Green, c.Blue)
+	return []protocol.ColorPresentation{{
+		Label:    label,
+		TextEdit: &protocol.TextEdit{Range: params.Range, NewText: label},
+	}}, nil
+}
+
+func TestDocumentColor(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+var color = "red"
+`
+	server := &colorServer{}
+	editor, _ := newTestEditor(t, files, server)
+	server.editor = editor
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "main.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := editor.DocumentColor(ctx, "go.mod"); err == nil {
+		t.Error("DocumentColor on an unopened buffer succeeded unexpectedly")
+	}
+	colors, err := editor.DocumentColor(ctx, "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := editor.RegexpSearch("main.go", `"(red)"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protocol.ColorInformation{{Range: loc.Range, Color: red}}
+	if diff := cmp.Diff(want, colors); diff != "" {
+		t.Errorf("DocumentColor mismatch (-want +got):\n%s", diff)
+	}
+
+	presentations, err := editor.ColorPresentation(ctx, loc, red)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presentations) != 1 || presentations[0].Label != "rgb(1, 0, 0)" || presentations[0].TextEdit.Range != loc.Range {
+		t.Errorf("ColorPresentation = %+v, want a single rgb(1, 0, 0) presentation replacing %v", presentations, loc.Range)
+	}
+}
+
+// monikerServer is a stub server that reports an exported moniker for the
+// identifier at the requested position.
+type monikerServer struct {
+	stubServer
+	editor *Editor
+}
+
+func (s *monikerServer) Moniker(_ context.Context, params *protocol.MonikerParams) ([]protocol.Moniker, error) {
+	text, ok := s.editor.BufferText(s.editor.sandbox.Workdir.URIToPath(params.TextDocument.URI))
+	if !ok {
+		return nil, fmt.Errorf("unknown document %s", params.TextDocument.URI)
+	}
+	line := strings.Split(text, "\n")[params.Position.Line]
+	ident := strings.FieldsFunc(line[params.Position.Character:], func(r rune) bool { return !unicode.IsLetter(r) })[0]
+	kind := protocol.Export
+	return []protocol.Moniker{{
+		Scheme:     "gomod",
+		Identifier: "mod.com/p." + ident,
+		Unique:     protocol.Global,
+		Kind:       &kind,
+	}}, nil
+}
+
+func TestMoniker(t *testing.T) {
+	server := &monikerServer{}
+	editor, ws := newTestEditor(t, multiFileProgram, server)
+	server.editor = editor
+	ctx := context.Background()
+	if err := editor.OpenFile(ctx, "a.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	loc, err := editor.RegexpSearch("a.go", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monikers, err := editor.Moniker(ctx, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind := protocol.Export
+	want := []protocol.Moniker{{Scheme: "gomod", Identifier: "mod.com/p.A", Unique: protocol.Global, Kind: &kind}}
+	if diff := cmp.Diff(want, monikers); diff != "" {
+		t.Errorf("Moniker mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := editor.Moniker(ctx, ws.Workdir.EntireFile("b.go")); err == nil {
+		t.Error("Moniker in an unopened buffer succeeded unexpectedly")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+)
+
+// progressState tracks the $/progress notifications received by the Client,
+// so that the Editor can await the completion of server-side work.
+type progressState struct {
+	mu      sync.Mutex
+	changed chan struct{}                     // closed and replaced on each change
+	titles  map[protocol.ProgressToken]string // token -> title, once begun
+	ended   map[protocol.ProgressToken]bool   // tokens whose work has ended
+	err     error                             // first failure to read a progress value, if any
+
+	// partial holds the handlers for partial results streamed by the server,
+	// keyed by the partial result token passed in the request.
+	partial   map[protocol.ProgressToken]func(any) error
+	nextToken int // for generating partial result tokens
+}
+
+func newProgressState() *progressState {
+	return &progressState{
+		changed: make(chan struct{}),
+		titles:  make(map[protocol.ProgressToken]string),
+		ended:   make(map[protocol.ProgressToken]bool),
+		partial: make(map[protocol.ProgressToken]func(any) error),
+	}
+}
+
+// registerPartialResults returns a new partial result token, whose
+// $/progress notifications are passed to handle until unregister is called.
+func (p *progressState) registerPartialResults(handle func(any) error) (token protocol.ProgressToken, unregister func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextToken++
+	token = fmt.Sprintf("partial-%d", p.nextToken)
+	p.partial[token] = handle
+	return token, func() {
+		p.mu.Lock()
+		delete(p.partial, token)
+		p.mu.Unlock()
+	}
+}
+
+// partialResult passes the value of the given notification to the handler
+// for its token, if it is a registered partial result token. It reports
+// whether the notification was handled.
+func (p *progressState) partialResult(params *protocol.ProgressParams) (bool, error) {
+	p.mu.Lock()
+	handle, ok := p.partial[params.Token]
+	p.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, handle(params.Value)
+}
+
+// update records the given progress notification. A value that cannot be
+// read is recorded as the error of subsequent awaits.
+func (p *progressState) update(params *protocol.ProgressParams) {
+	// The progress value is one of WorkDoneProgressBegin, Report, or End,
+	// distinguished by its kind.
+	v, err := marshalUnmarshal[struct {
+		Kind  string `json:"kind"`
+		Title string `json:"title"`
+	}](params.Value)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err != nil:
+		if p.err == nil {
+			p.err = fmt.Errorf("reading progress for token %v: %v", params.Token, err)
+		}
+	case v.Kind == "begin":
+		p.titles[params.Token] = v.Title
+	case v.Kind == "end":
+		p.ended[params.Token] = true
+	default:
+		return
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// await blocks until cond, which is called with p.mu held, reports true, or
+// ctx is done. It fails if a progress value could not be read.
+func (p *progressState) await(ctx context.Context, cond func() bool) error {
+	for {
+		p.mu.Lock()
+		met, changed, err := cond(), p.changed, p.err
+		p.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if met {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// AwaitProgressToken blocks until the server has begun work with the given
+// title that has not yet ended, and returns its progress token.
+func (e *Editor) AwaitProgressToken(ctx context.Context, title string) (protocol.ProgressToken, error) {
+	var token protocol.ProgressToken
+	err := e.progress.await(ctx, func() bool {
+		for tok, t := range e.progress.titles {
+			if t == title && !e.progress.ended[tok] {
+				token = tok
+				return true
+			}
+		}
+		return false
+	})
+	return token, err
+}
+
+// AwaitProgress blocks until the server ends work whose title matches the
+// regular expression titlePattern.
+//
+// Only work that has not ended when AwaitProgress is called counts, so
+// callers awaiting work triggered by an operation must ensure the work is
+// still in progress, for example using AwaitProgressToken.
+func (e *Editor) AwaitProgress(ctx context.Context, titlePattern string) error {
+	re, err := regexp.Compile(titlePattern)
+	if err != nil {
+		return err
+	}
+	e.progress.mu.Lock()
+	ended := make(map[protocol.ProgressToken]bool, len(e.progress.ended))
+	for tok := range e.progress.ended {
+		ended[tok] = true
+	}
+	e.progress.mu.Unlock()
+	return e.progress.await(ctx, func() bool {
+		for tok := range e.progress.ended {
+			if !ended[tok] && re.MatchString(e.progress.titles[tok]) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// CancelProgress asks the server to cancel the in-progress work identified by
+// token, by sending a window/workDoneProgress/cancel notification. The work
+// is not necessarily complete when CancelProgress returns; callers should
+// await its end.
+func (e *Editor) CancelProgress(ctx context.Context, token protocol.ProgressToken) error {
+	if e.Server == nil {
+		return nil
+	}
+	e.progress.mu.Lock()
+	_, begun := e.progress.titles[token]
+	ended := e.progress.ended[token]
+	e.progress.mu.Unlock()
+	if !begun || ended {
+		return fmt.Errorf("no work in progress for token %v", token)
+	}
+	if err := e.Server.WorkDoneProgressCancel(ctx, &protocol.WorkDoneProgressCancelParams{Token: token}); err != nil {
+		return fmt.Errorf("window/workDoneProgress/cancel: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package fake
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -269,6 +270,28 @@ func (sb *Sandbox) GoVersion(ctx context.Context) (int, error) {
 	return gocommand.GoVersion(ctx, inv, &sb.goCommandRunner)
 }
 
+// GoEnvValues returns the values of the given Go environment variables, as
+// reported by 'go env' in dir with env applied on top of the sandbox
+// environment.
+func (sb *Sandbox) GoEnvValues(ctx context.Context, dir string, env []string, vars ...string) (map[string]string, error) {
+	inv := sb.goCommandInvocation()
+	inv.Verb = "env"
+	inv.Args = append([]string{"-json"}, vars...)
+	inv.Env = append(inv.Env, env...)
+	if dir != "" {
+		inv.WorkingDir = sb.Workdir.AbsPath(dir)
+	}
+	stdout, err := sb.goCommandRunner.Run(ctx, inv)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal(stdout.Bytes(), &values); err != nil {
+		return nil, fmt.Errorf("decoding go env output: %v", err)
+	}
+	return values, nil
+}
+
 // Close removes all state associated with the sandbox.
 func (sb *Sandbox) Close() error {
 	var goCleanErr error
@@ -16,6 +16,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/tools/gopls/internal/protocol"
@@ -36,14 +37,53 @@ func (r RelativeTo) AbsPath(path string) string {
 
 // RelPath returns a '/'-encoded path relative to the working directory (or an
 // absolute path if the file is outside of workdir)
+//
+// If fp is not lexically within the working directory, RelPath also tries
+// again after resolving symbolic links in both paths, since the server may
+// report the real path of a file that the editor reached through a symlink
+// (for example, if the workdir or GOPATH is itself a symlink).
 func (r RelativeTo) RelPath(fp string) string {
 	root := string(r)
-	if rel, err := filepath.Rel(root, fp); err == nil && !strings.HasPrefix(rel, "..") {
+	if rel, ok := relPath(root, fp); ok {
 		return filepath.ToSlash(rel)
 	}
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		if realFP, err := evalSymlinks(fp); err == nil {
+			if rel, ok := relPath(realRoot, realFP); ok {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
 	return filepath.ToSlash(fp)
 }
 
+// relPath returns the path of fp relative to root, and reports whether fp is
+// within root.
+func relPath(root, fp string) (string, bool) {
+	rel, err := filepath.Rel(root, fp)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// evalSymlinks is like filepath.EvalSymlinks, but tolerates a final path
+// element that does not (yet) exist.
+func evalSymlinks(fp string) (string, error) {
+	real, err := filepath.EvalSymlinks(fp)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(fp))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(fp)), nil
+}
+
 // writeFileData writes content to the relative path, replacing the special
 // token $SANDBOX_WORKDIR with the relative root given by rel. It does not
 // trigger any file events.
@@ -83,6 +123,8 @@ type Workdir struct {
 	watcherMu sync.Mutex
 	watchers  []func(context.Context, []protocol.FileEvent)
 
+	readLatency atomic.Int64 // time.Duration injected before each ReadFile
+
 	fileMu sync.Mutex
 	// File identities we know about, for the purpose of detecting changes.
 	//
@@ -154,8 +196,17 @@ func (w *Workdir) EntireFile(path string) protocol.Location {
 	return protocol.Location{URI: w.URI(path)}
 }
 
+// SetReadLatency causes each subsequent call to ReadFile to sleep for d
+// before reading, to simulate slow I/O. The default latency is zero.
+func (w *Workdir) SetReadLatency(d time.Duration) {
+	w.readLatency.Store(int64(d))
+}
+
 // ReadFile reads a text file specified by a workdir-relative path.
 func (w *Workdir) ReadFile(path string) ([]byte, error) {
+	if d := time.Duration(w.readLatency.Load()); d > 0 {
+		time.Sleep(d)
+	}
 	backoff := 1 * time.Millisecond
 	for {
 		b, err := os.ReadFile(w.AbsPath(path))
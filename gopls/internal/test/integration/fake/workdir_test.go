@@ -7,6 +7,7 @@ package fake
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -197,6 +198,44 @@ func TestWorkdir_CheckForFileChanges(t *testing.T) {
 	checkChange("newFile", protocol.Deleted)
 }
 
+// Test that RelPath maps paths reported through the real (symlink-resolved)
+// location of a symlinked GOPATH back to workdir-relative paths.
+func TestRelativeTo_RelPathSymlink(t *testing.T) {
+	tmpdir := t.TempDir()
+	realGopath := filepath.Join(tmpdir, "real", "gopath")
+	for _, dir := range []string{"src/work/a", "pkg/mod/other.com/b@v1.0.0"} {
+		if err := os.MkdirAll(filepath.Join(realGopath, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gopath := filepath.Join(tmpdir, "gopath")
+	if err := os.Symlink(realGopath, gopath); err != nil {
+		t.Skipf("creating symlink: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(realGopath, "src", "work", "a", "a.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	modFile := filepath.Join(realGopath, "pkg", "mod", "other.com", "b@v1.0.0", "b.go")
+	if err := os.WriteFile(modFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rel := RelativeTo(filepath.Join(gopath, "src", "work"))
+	tests := []struct {
+		fp, want string
+	}{
+		{filepath.Join(gopath, "src", "work", "a", "a.go"), "a/a.go"},
+		{filepath.Join(realGopath, "src", "work", "a", "a.go"), "a/a.go"},
+		{filepath.Join(realGopath, "src", "work", "a", "new.go"), "a/new.go"},
+		{modFile, filepath.ToSlash(modFile)},
+	}
+	for _, test := range tests {
+		if got := rel.RelPath(test.fp); got != test.want {
+			t.Errorf("RelPath(%q) = %q, want %q", test.fp, got, test.want)
+		}
+	}
+}
+
 func TestSplitModuleVersionPath(t *testing.T) {
 	tests := []struct {
 		path                                string
@@ -5,8 +5,10 @@
 package misc
 
 import (
+	"sort"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/tools/gopls/internal/protocol"
 	. "golang.org/x/tools/gopls/internal/test/integration"
 )
@@ -34,3 +36,137 @@ package pkg
 		env.Editor.Server.PrepareCallHierarchy(env.Ctx, &params)
 	})
 }
+
+// Test that PrepareCallHierarchy opens the file containing the location if
+// necessary.
+func TestPrepareCallHierarchyUnopened(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a/a.go --
+package a
+
+func F() {}
+-- b/b.go --
+package b
+
+import "mod.com/a"
+
+func G() { a.F() }
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		loc := env.RegexpSearch("a/a.go", "F")
+		if env.Editor.HasBuffer("a/a.go") {
+			t.Fatal("a/a.go is unexpectedly open")
+		}
+		items := env.PrepareCallHierarchy(loc)
+		if len(items) != 1 || items[0].Name != "F" {
+			t.Fatalf("PrepareCallHierarchy: got %v, want a single item for F", items)
+		}
+		if !env.Editor.HasBuffer("a/a.go") {
+			t.Error("PrepareCallHierarchy did not open a/a.go")
+		}
+		calls := env.IncomingCalls(items[0])
+		if len(calls) != 1 || calls[0].From.Name != "G" {
+			t.Errorf("IncomingCalls: got %v, want a single call from G", calls)
+		}
+	})
+}
+
+func TestCallHierarchyGraph(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- p.go --
+package p
+
+func A() {
+	B()
+	C()
+}
+
+func B() { C() }
+
+func C() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("p.go")
+		item := func(name string) protocol.CallHierarchyItem {
+			t.Helper()
+			items := env.PrepareCallHierarchy(env.RegexpSearch("p.go", "func ("+name+")"))
+			if len(items) != 1 {
+				t.Fatalf("PrepareCallHierarchy(%s): got %d items, want 1", name, len(items))
+			}
+			return items[0]
+		}
+
+		var callers []string
+		for _, call := range env.IncomingCalls(item("C")) {
+			callers = append(callers, call.From.Name)
+		}
+		sort.Strings(callers)
+		if diff := cmp.Diff([]string{"A", "B"}, callers); diff != "" {
+			t.Errorf("IncomingCalls(C): unexpected callers (-want +got):\n%s", diff)
+		}
+
+		var callees []string
+		for _, call := range env.OutgoingCalls(item("A")) {
+			callees = append(callees, call.To.Name)
+		}
+		sort.Strings(callees)
+		if diff := cmp.Diff([]string{"B", "C"}, callees); diff != "" {
+			t.Errorf("OutgoingCalls(A): unexpected callees (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestPrepareCallHierarchyBatch(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- p.go --
+package p
+
+func A() {}
+
+func B() {}
+
+func C() {}
+-- q/q.go --
+package q
+
+func D() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("p.go")
+		names := map[protocol.Location]string{}
+		var locs []protocol.Location
+		for _, name := range []string{"A", "B", "C"} {
+			loc := env.RegexpSearch("p.go", "func ("+name+")")
+			names[loc] = name
+			locs = append(locs, loc)
+		}
+		// The batch opens q/q.go as needed.
+		dloc := protocol.Location{URI: env.Sandbox.Workdir.URI("q/q.go")}
+		dloc.Range.Start = protocol.Position{Line: 2, Character: 5}
+		dloc.Range.End = dloc.Range.Start
+		names[dloc] = "D"
+		locs = append(locs, dloc)
+
+		got := env.PrepareCallHierarchyBatch(locs...)
+		if len(got) != len(locs) {
+			t.Fatalf("PrepareCallHierarchyBatch: got %d results, want %d", len(got), len(locs))
+		}
+		for loc, items := range got {
+			if len(items) != 1 || items[0].Name != names[loc] {
+				t.Errorf("PrepareCallHierarchyBatch(%s): got %v, want one item named %s", names[loc], items, names[loc])
+			}
+		}
+	})
+}
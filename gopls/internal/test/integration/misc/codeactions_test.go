@@ -6,10 +6,12 @@ package misc
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/tools/gopls/internal/protocol"
+	"golang.org/x/tools/gopls/internal/protocol/command"
 	"golang.org/x/tools/gopls/internal/settings"
 	. "golang.org/x/tools/gopls/internal/test/integration"
 	"golang.org/x/tools/gopls/internal/util/slices"
@@ -116,3 +118,75 @@ func Func() int { return 0 }
 		}
 	})
 }
+
+func TestChangeSignatureRemoveParameter(t *testing.T) {
+	const src = `
+-- go.mod --
+module example.com
+go 1.19
+
+-- a/a.go --
+package a
+
+func F(x, unused int) int {
+	return x
+}
+-- b/b.go --
+package b
+
+import "example.com/a"
+
+var _ = a.F(1, 2)
+-- c/c.go --
+package c
+
+import "example.com/a"
+
+var _ = a.F(3, 4)
+`
+	Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		env.ChangeSignature(command.ChangeSignatureArgs{
+			RemoveParameter: env.RegexpSearch("a/a.go", "unused"),
+		})
+		for file, want := range map[string]string{
+			"a/a.go": "func F(x int) int {",
+			"b/b.go": "var _ = a.F(1)",
+			"c/c.go": "var _ = a.F(3)",
+		} {
+			if got := env.FileContent(file); !strings.Contains(got, want) {
+				t.Errorf("%s does not contain %q:\n%s", file, want, got)
+			}
+		}
+	})
+}
+
+// Test that requesting a parent code action kind returns actions of its
+// child kinds, as CodeActionKinds form a hierarchy.
+func TestCodeActionKindHierarchy(t *testing.T) {
+	const src = `
+-- go.mod --
+module example.com
+go 1.19
+
+-- a.go --
+package a
+
+func f(x int) int {
+	return x * 2
+}
+`
+	Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		loc := env.RegexpSearch("a.go", `x \* 2`)
+		var titles []string
+		for _, action := range env.CodeActionsOfKind(loc, protocol.Refactor) {
+			if action.Kind == protocol.RefactorExtract {
+				titles = append(titles, action.Title)
+			}
+		}
+		if !slices.Contains(titles, "Extract variable") {
+			t.Errorf("refactor code actions include extractions %q, want %q", titles, "Extract variable")
+		}
+	})
+}
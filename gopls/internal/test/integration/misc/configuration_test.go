@@ -5,6 +5,7 @@
 package misc
 
 import (
+	"reflect"
 	"testing"
 
 	. "golang.org/x/tools/gopls/internal/test/integration"
@@ -49,6 +50,121 @@ var FooErr = errors.New("foo")
 	})
 }
 
+// Test that toggling an analyzer through the "analyses" setting shows and
+// hides its diagnostics.
+func TestToggleAnalyzer(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a/a.go --
+package a
+
+func f(unused int) {
+	println()
+}
+
+func _() { f(1) }
+`
+	WithOptions(
+		Settings{"analyses": map[string]any{"nilness": false}},
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("a/a.go", "unused int"), WithMessage("unused parameter")),
+		)
+		env.SetAnalyzerEnabled("unusedparams", false)
+		env.AfterChange(
+			NoDiagnostics(ForFile("a/a.go")),
+		)
+		if got := env.Editor.Config().Settings["analyses"]; !reflect.DeepEqual(got, map[string]any{"nilness": false, "unusedparams": false}) {
+			t.Errorf("analyses setting = %v, want nilness and unusedparams disabled", got)
+		}
+		env.SetAnalyzerEnabled("unusedparams", true)
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("a/a.go", "unused int"), WithMessage("unused parameter")),
+		)
+	})
+}
+
+// Test that gopls applies configuration changes when the client pushes its
+// settings in didChangeConfiguration.
+func TestPushConfiguration(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a/a.go --
+package a
+
+func f(unused int) {
+	println()
+}
+
+func _() { f(1) }
+`
+	WithOptions(
+		PushConfiguration(),
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		env.AfterChange(
+			Diagnostics(env.AtRegexp("a/a.go", "unused int")),
+		)
+		cfg := env.Editor.Config()
+		cfg.Settings = map[string]any{
+			"analyses": map[string]any{"unusedparams": false},
+		}
+		env.ChangeConfiguration(cfg)
+		env.AfterChange(
+			NoDiagnostics(ForFile("a/a.go")),
+		)
+
+		params, ok := env.Editor.LastConfigurationChange()
+		if !ok {
+			t.Fatal("no didChangeConfiguration notification was sent")
+		}
+		settings, _ := params.Settings.(map[string]any)
+		want := map[string]any{"unusedparams": false}
+		if got := settings["analyses"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("pushed analyses setting = %v, want %v", got, want)
+		}
+	})
+}
+
+// Test that settings are still applied via initializationOptions when the
+// client doesn't support the workspace/configuration request.
+func TestNoWorkspaceConfiguration(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package p
+
+func _() {
+	var x *int
+	y := *x
+	_ = y
+}
+`
+	WithOptions(
+		NoWorkspaceConfiguration(),
+		Settings{
+			"analyses": map[string]any{
+				"nilness": false,
+			},
+		},
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		env.AfterChange(
+			NoDiagnostics(WithMessage("nil dereference")),
+		)
+	})
+}
+
 func TestIdenticalConfiguration(t *testing.T) {
 	// This test checks that changing configuration does not cause views to be
 	// recreated if there is no configuration change.
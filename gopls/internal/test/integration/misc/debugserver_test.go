@@ -44,3 +44,17 @@ func TestStartDebugging(t *testing.T) {
 		}
 	})
 }
+
+func TestStartDebuggingURL(t *testing.T) {
+	Run(t, "", func(t *testing.T, env *Env) {
+		url := env.StartDebugging()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("getting debug url %q: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Errorf("debug server returned HTTP %d, want %d", got, want)
+		}
+	})
+}
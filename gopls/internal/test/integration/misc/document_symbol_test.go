@@ -0,0 +1,51 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"testing"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+	. "golang.org/x/tools/gopls/internal/test/integration"
+)
+
+func TestDocumentSymbols(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+type T struct {
+	F int
+}
+
+func (T) M() {}
+
+func G() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		symbols := env.DocumentSymbols("a.go")
+		kinds := make(map[string]protocol.SymbolKind)
+		var children []string
+		for _, sym := range symbols {
+			kinds[sym.Name] = sym.Kind
+			if sym.Name == "T" {
+				for _, child := range sym.Children {
+					children = append(children, child.Name)
+				}
+			}
+		}
+		if kinds["T"] != protocol.Struct || kinds["G"] != protocol.Function {
+			t.Errorf("DocumentSymbols: got kinds %v, want struct T and function G", kinds)
+		}
+		if len(children) != 1 || children[0] != "F" {
+			t.Errorf("DocumentSymbols: got children %v of T, want [F]", children)
+		}
+	})
+}
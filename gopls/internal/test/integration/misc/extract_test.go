@@ -64,3 +64,176 @@ func newFunction() int {
 		}
 	})
 }
+
+func TestExtractFunctionReturnValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		selection string // regexp matching the statements to extract
+		want      string
+	}{
+		{
+			name: "one result",
+			src: `package main
+
+func F(x int) int {
+	y := x * 2
+	return y
+}
+`,
+			selection: `y := x \* 2`,
+			want: `package main
+
+func F(x int) int {
+	y := newFunction(x)
+	return y
+}
+
+func newFunction(x int) int {
+	y := x * 2
+	return y
+}
+`,
+		},
+		{
+			name: "two results",
+			src: `package main
+
+func F(x int) int {
+	y := x * 2
+	z := x + 1
+	return y + z
+}
+`,
+			selection: `y := x \* 2\n\tz := x \+ 1`,
+			want: `package main
+
+func F(x int) int {
+	y, z := newFunction(x)
+	return y + z
+}
+
+func newFunction(x int) (int, int) {
+	y := x * 2
+	z := x + 1
+	return y, z
+}
+`,
+		},
+		{
+			name: "mutates outer variable",
+			src: `package main
+
+func F(x int) int {
+	total := 0
+	total += x
+	total *= 2
+	return total
+}
+`,
+			selection: `total \+= x\n\ttotal \*= 2`,
+			want: `package main
+
+func F(x int) int {
+	total := 0
+	total = newFunction(total, x)
+	return total
+}
+
+func newFunction(total int, x int) int {
+	total += x
+	total *= 2
+	return total
+}
+`,
+		},
+		{
+			name: "early return",
+			src: `package main
+
+func F(x int) int {
+	if x < 0 {
+		return 0
+	}
+	return x
+}
+`,
+			selection: `if x < 0 {\n\t\treturn 0\n\t}`,
+			want: `package main
+
+func F(x int) int {
+	shouldReturn, returnValue := newFunction(x)
+	if shouldReturn {
+		return returnValue
+	}
+	return x
+}
+
+func newFunction(x int) (bool, int) {
+	if x < 0 {
+		return true, 0
+	}
+	return false, 0
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := "-- go.mod --\nmodule mod.com\n\ngo 1.12\n-- main.go --\n" + test.src
+			Run(t, files, func(t *testing.T, env *Env) {
+				env.OpenFile("main.go")
+				env.ExtractFunction(env.RegexpSearch("main.go", test.selection))
+				got := env.BufferText("main.go")
+				if got != test.want {
+					t.Errorf("ExtractFunction produced unexpected result:\n%s", compare.Text(test.want, got))
+				}
+			})
+		})
+	}
+}
+
+func TestPreviewExtractFunction(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+func F(x int) int {
+	y := x * 2
+	return y
+}
+`
+	const want = `func F(x int) int {
+	y := newFunction(x)
+	return y
+}
+
+func newFunction(x int) int {
+	y := x * 2
+	return y
+}`
+	for _, capabilities := range []string{
+		"{}",
+		`{ "textDocument": {"codeAction": { "dataSupport": true, "resolveSupport": { "properties": ["edit"] } } } }`,
+	} {
+		WithOptions(CapabilitiesJSON([]byte(capabilities))).Run(t, files, func(t *testing.T, env *Env) {
+			env.OpenFile("main.go")
+			before := env.BufferText("main.go")
+			wsedit := env.PreviewCodeAction(env.RegexpSearch("main.go", `y := x \* 2`), "Extract function")
+			if got := env.BufferText("main.go"); got != before {
+				t.Errorf("PreviewCodeAction modified main.go:\n%s", compare.Text(before, got))
+			}
+			if len(wsedit.DocumentChanges) != 1 || wsedit.DocumentChanges[0].TextDocumentEdit == nil {
+				t.Fatalf("PreviewCodeAction: got %+v, want a single text document edit", wsedit)
+			}
+			edits := protocol.AsTextEdits(wsedit.DocumentChanges[0].TextDocumentEdit.Edits)
+			if len(edits) != 1 || edits[0].NewText != want {
+				t.Errorf("PreviewCodeAction: got edits %+v, want a single edit with text:\n%s", edits, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"testing"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+	. "golang.org/x/tools/gopls/internal/test/integration"
+)
+
+func TestFoldingRange(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+import (
+	"fmt"
+	"strings"
+)
+
+func F() {
+	if true {
+		fmt.Println(strings.ToUpper("x"))
+	}
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		if _, err := env.Editor.FoldingRange(env.Ctx, "a.go"); err == nil {
+			t.Errorf("FoldingRange on an unopened buffer succeeded unexpectedly")
+		}
+		env.OpenFile("a.go")
+		ranges := env.FoldingRange("a.go")
+		foldsAt := func(re string, kind protocol.FoldingRangeKind) bool {
+			line := env.RegexpSearch("a.go", re).Range.Start.Line
+			for _, r := range ranges {
+				if r.StartLine == line && r.Kind == string(kind) {
+					return true
+				}
+			}
+			return false
+		}
+		if !foldsAt("import", protocol.Imports) {
+			t.Errorf("FoldingRange: missing imports fold in %v", ranges)
+		}
+		if !foldsAt("if true", "") {
+			t.Errorf("FoldingRange: missing fold for if block in %v", ranges)
+		}
+	})
+}
+
+func TestImportFoldingRange(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func F() {
+	fmt.Fprintln(os.Stdout, strings.ToUpper("x"))
+}
+-- b.go --
+package a
+
+func G() {}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		fold := env.ImportFoldingRange("a.go")
+		start := env.RegexpSearch("a.go", `import \(`).Range.Start.Line
+		end := env.RegexpSearch("a.go", `"strings"\n(\))`).Range.Start.Line
+		if fold.StartLine != start || fold.EndLine != end {
+			t.Errorf("ImportFoldingRange: got lines %d-%d, want %d-%d", fold.StartLine, fold.EndLine, start, end)
+		}
+
+		env.OpenFile("b.go")
+		if _, err := env.Editor.ImportFoldingRange(env.Ctx, "b.go"); err == nil {
+			t.Errorf("ImportFoldingRange on a file without imports succeeded unexpectedly")
+		}
+	})
+}
@@ -5,9 +5,11 @@
 package misc
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"golang.org/x/tools/gopls/internal/protocol"
 	"golang.org/x/tools/gopls/internal/test/compare"
 	. "golang.org/x/tools/gopls/internal/test/integration"
 	"golang.org/x/tools/internal/testenv"
@@ -167,6 +169,45 @@ func TestFormattingOnSave(t *testing.T) {
 	})
 }
 
+func TestEditAndSave(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+func main() {
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		// Each edit adds an unformatted statement using an unimported
+		// package, and is immediately saved.
+		const n = 10
+		for i := 0; i < n; i++ {
+			loc := env.RegexpSearch("main.go", `func main\(\) {\n()`)
+			env.EditAndSave("main.go", []protocol.TextEdit{{
+				Range:   loc.Range,
+				NewText: fmt.Sprintf("fmt.Println(  %d  )\n", i),
+			}})
+		}
+		var want strings.Builder
+		want.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+		for i := n - 1; i >= 0; i-- {
+			fmt.Fprintf(&want, "\tfmt.Println(%d)\n", i)
+		}
+		want.WriteString("}\n")
+		if got := env.BufferText("main.go"); got != want.String() {
+			t.Errorf("unexpected buffer content after EditAndSave:\n%s", compare.Text(want.String(), got))
+		}
+		if got := env.ReadWorkspaceFile("main.go"); got != want.String() {
+			t.Errorf("unexpected file content after EditAndSave:\n%s", compare.Text(want.String(), got))
+		}
+	})
+}
+
 // Tests various possibilities for comments in files with CRLF line endings.
 // Import organization in these files has historically been a source of bugs.
 func TestCRLFLineEndings(t *testing.T) {
@@ -231,6 +231,30 @@ func main() {
 	})
 }
 
+func TestHoverImportStd(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello")
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		got := env.HoverImport("main.go", "fmt")
+		if want := "Package fmt implements formatted I/O"; got == nil || !strings.Contains(got.Value, want) {
+			t.Errorf("HoverImport(%q): got %v, want content containing %q", "fmt", got, want)
+		}
+	})
+}
+
 // for x/tools/gopls: unhandled named anchor on the hover #57048
 func TestHoverTags(t *testing.T) {
 	const source = `
@@ -722,3 +746,73 @@ func _() {
 		}
 	})
 }
+
+// Test that hovering over a call to a generic function with inferred type
+// arguments shows the signature instantiated with those arguments.
+func TestHoverGenericInstantiation(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- main.go --
+package main
+
+import "strconv"
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	var res []U
+	for _, x := range s {
+		res = append(res, f(x))
+	}
+	return res
+}
+
+var _ = Map([]int{1}, strconv.Itoa)
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		content, _ := env.Hover(env.RegexpSearch("main.go", `_ = (Map)`))
+		if content == nil {
+			t.Fatal("no hover content for call to Map")
+		}
+		const want = "func Map(s []int, f func(int) string) []string"
+		if content.Kind != protocol.Markdown || !strings.Contains(content.Value, want) {
+			t.Errorf("hover for Map[int, string]: got %s content\n%s\nwant it to contain %q", content.Kind, content.Value, want)
+		}
+	})
+}
+
+func TestHoverRequestDurations(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- a.go --
+package a
+
+func F() int { return 1 }
+
+var _ = F()
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		const n = 5
+		for i := 0; i < n; i++ {
+			env.Hover(env.RegexpSearch("a.go", `_ = (F)`))
+		}
+		durations := env.Editor.RequestDurations()["textDocument/hover"]
+		if len(durations) != n {
+			t.Fatalf("got %d hover durations, want %d", len(durations), n)
+		}
+		for i, d := range durations {
+			if d <= 0 {
+				t.Errorf("hover %d took %v, want a positive duration", i, d)
+			}
+		}
+		if len(env.Editor.RequestDurations()["initialize"]) != 1 {
+			t.Errorf("initialize request duration not recorded")
+		}
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"golang.org/x/tools/gopls/internal/protocol/command"
 	"golang.org/x/tools/gopls/internal/test/compare"
 	. "golang.org/x/tools/gopls/internal/test/integration"
+	"golang.org/x/tools/gopls/internal/util/slices"
 )
 
 func TestAddImport(t *testing.T) {
@@ -56,6 +57,45 @@ func main() {
 	})
 }
 
+func TestAddImportToBlock(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+func main() {
+	os.Exit(len(strings.Fields("")))
+}
+`
+	const want = `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	os.Exit(len(strings.Fields("")))
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.AddImport("main.go", "fmt")
+		if got := env.BufferText("main.go"); got != want {
+			t.Fatalf("AddImport(%q) failed\n%s", "fmt", compare.Text(want, got))
+		}
+	})
+}
+
 func TestListImports(t *testing.T) {
 	const files = `
 -- go.mod --
@@ -131,3 +171,33 @@ func TestFoo2(t *testing.T) {}
 
 	})
 }
+
+func TestListKnownPackages(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a/a.go --
+package a
+
+const A = 1
+-- main.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello world")
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		pkgs := env.ListKnownPackages("main.go")
+		for _, want := range []string{"bytes", "mod.com/a"} {
+			if !slices.Contains(pkgs, want) {
+				t.Errorf("ListKnownPackages(main.go) does not contain %q", want)
+			}
+		}
+	})
+}
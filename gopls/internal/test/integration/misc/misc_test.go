@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/telemetry/counter/countertest"
 	"golang.org/x/tools/gopls/internal/protocol"
@@ -70,3 +71,97 @@ const K = 1
 		// fake editor's own handling of URIs.
 	})
 }
+
+// TestNoUnhandledServerRequests checks that the fake editor handles all
+// requests and notifications made by gopls during a typical session.
+func TestNoUnhandledServerRequests(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- main.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello")
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.RegexpReplace("main.go", "Hello", "Goodbye")
+		env.SaveBuffer("main.go")
+		env.AfterChange(NoDiagnostics(ForFile("main.go")))
+		if got := env.Editor.UnhandledServerRequests(); len(got) > 0 {
+			t.Errorf("unhandled server requests: %v", got)
+		}
+	})
+}
+
+// TestBOMAndCRLF checks that gopls handles a file with a UTF-8 byte order
+// mark and CRLF line endings through the open, edit, save cycle. The editor
+// sends the byte order mark to gopls as the first character of the file, so
+// it must be counted in positions on the first line.
+func TestBOMAndCRLF(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+`
+	const content = "\ufeffpackage main\r\n\r\nfunc main() {\r\n\tx := 1\r\n}\r\n"
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFileRaw("main.go", content)
+		env.AfterChange(
+			Diagnostics(AtPosition("main.go", 3, 1), WithMessage("declared and not used")),
+		)
+		if loc := env.RegexpSearch("main.go", "package"); loc.Range.Start != (protocol.Position{Line: 0, Character: 1}) {
+			t.Errorf("package keyword found at %v, want 0:1", loc.Range.Start)
+		}
+		env.RegexpReplace("main.go", "x :=", "_ =")
+		env.SaveBuffer("main.go")
+		env.AfterChange(
+			NoDiagnostics(ForFile("main.go")),
+		)
+		// Formatting on save drops the byte order mark, as gofmt does.
+		want := "package main\r\n\r\nfunc main() {\r\n\t_ = 1\r\n}\r\n"
+		if got := env.ReadWorkspaceFile("main.go"); got != want {
+			t.Errorf("saved main.go = %q, want %q", got, want)
+		}
+	})
+}
+
+// TestSlowFileReads checks that the session remains responsive when reading
+// files from the sandbox is slow.
+func TestSlowFileReads(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+func F() int { return G() }
+-- b.go --
+package a
+
+func G() int { return 1 }
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		const latency = 100 * time.Millisecond
+		env.Sandbox.Workdir.SetReadLatency(latency)
+		start := time.Now()
+		env.OpenFile("a.go")
+		env.OpenFile("b.go")
+		if elapsed := time.Since(start); elapsed < 2*latency {
+			t.Errorf("opening two files took %v, want at least %v", elapsed, 2*latency)
+		}
+		env.AfterChange(NoDiagnostics())
+		if _, loc := env.Hover(env.RegexpSearch("a.go", "G")); loc.URI == "" {
+			t.Errorf("Hover over G returned no location")
+		}
+	})
+}
@@ -572,3 +572,41 @@ func fileLocations(env *integration.Env, locs []protocol.Location) []string {
 	sort.Strings(got)
 	return got
 }
+
+// Test that requesting references with a partial result token yields the
+// same locations as an ordinary request. (gopls does not currently stream
+// references, so they arrive in the final response.)
+func TestReferencesStreaming(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a/a.go --
+package a
+
+func F() {}
+
+func _() { F() }
+-- b/b.go --
+package b
+
+import "mod.com/a"
+
+func _() { a.F() }
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		loc := env.RegexpSearch("a/a.go", `func (F)`)
+		var streamed []protocol.Location
+		env.ReferencesStreaming(loc, func(chunk []protocol.Location) {
+			streamed = append(streamed, chunk...)
+		})
+		if diff := cmp.Diff(env.References(loc), streamed); diff != "" {
+			t.Errorf("streamed references mismatch (-want +got):\n%s", diff)
+		}
+		if len(streamed) != 3 {
+			t.Errorf("got %d streamed references, want 3", len(streamed))
+		}
+	})
+}
@@ -6,6 +6,7 @@ package misc
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
@@ -357,6 +358,37 @@ func main() {
 	})
 }
 
+func TestRenameFieldPlaceholder(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+type T struct {
+	Field int
+}
+
+func _(t T) int {
+	return t.Field
+}
+`
+
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		loc := env.RegexpSearch("a.go", `t\.(Field)`)
+		if err := env.Editor.RenameWithPlaceholderCheck(env.Ctx, loc, "Renamed", "Other"); err == nil {
+			t.Errorf("RenameWithPlaceholderCheck with wrong placeholder succeeded unexpectedly")
+		}
+		env.RenameWithPlaceholderCheck(loc, "Renamed", "Field")
+		if text := env.BufferText("a.go"); strings.Contains(text, "Field") {
+			t.Errorf("a.go: unexpected token `Field` after rename:\n%s", text)
+		}
+	})
+}
+
 // This is a test that rename operation initiated by the editor function as expected.
 func TestRenameFileFromEditor(t *testing.T) {
 	const files = `
@@ -919,3 +951,82 @@ func checkTestdata(t *testing.T, env *Env) {
 		}
 	}
 }
+
+func TestPrepareRename(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- a.go --
+package a
+
+func Greet(name string) string {
+	_ = name
+	return "hello " + name
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		loc := env.RegexpSearch("a.go", `return "hello " \+ (name)`)
+		res := env.PrepareRename(loc)
+		if res == nil {
+			t.Fatalf("PrepareRename(name) returned no result")
+		}
+		if res.Placeholder != "name" || res.Range != loc.Range {
+			t.Errorf("PrepareRename(name) = %q at %v, want %q at %v", res.Placeholder, res.Range, "name", loc.Range)
+		}
+
+		// Keywords and the blank identifier cannot be renamed.
+		for _, re := range []string{`(func) Greet`, `(_) = name`} {
+			res, err := env.Editor.PrepareRename(env.Ctx, env.RegexpSearch("a.go", re))
+			if err == nil && res != nil {
+				t.Errorf("PrepareRename(%s) = %q at %v, want rejection", re, res.Placeholder, res.Range)
+			}
+		}
+	})
+}
+
+func TestRenameReturningEdit(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- a/a.go --
+package a
+
+func Greet() string { return "hello" }
+-- b/b.go --
+package b
+
+import "mod.com/a"
+
+var _ = a.Greet()
+-- c/c.go --
+package c
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		wsedit := env.RenameReturningEdit(env.RegexpSearch("a/a.go", "Greet"), "Hello")
+		if wsedit == nil {
+			t.Fatal("RenameReturningEdit returned no edit")
+		}
+		var got []string
+		for _, change := range wsedit.DocumentChanges {
+			if change.TextDocumentEdit != nil {
+				got = append(got, env.Sandbox.Workdir.URIToPath(change.TextDocumentEdit.TextDocument.URI))
+			}
+		}
+		for uri := range wsedit.Changes {
+			got = append(got, env.Sandbox.Workdir.URIToPath(uri))
+		}
+		sort.Strings(got)
+		if want := []string{"a/a.go", "b/b.go"}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("RenameReturningEdit touched files %v, want %v", got, want)
+		}
+		if text := env.BufferText("b/b.go"); !strings.Contains(text, "a.Hello()") {
+			t.Errorf("renamed edit was not applied to b/b.go:\n%s", text)
+		}
+	})
+}
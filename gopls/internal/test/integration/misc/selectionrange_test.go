@@ -0,0 +1,54 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"testing"
+
+	"golang.org/x/tools/gopls/internal/protocol"
+	. "golang.org/x/tools/gopls/internal/test/integration"
+)
+
+func TestSelectionRange(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.12
+-- a.go --
+package a
+
+func F(x, y int) int {
+	return x + y*2
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a.go")
+		x := env.RegexpSearch("a.go", `return (x)`)
+		y := env.RegexpSearch("a.go", `(y)\*2`)
+		ranges := env.SelectionRange(x, y)
+		if len(ranges) != 2 {
+			t.Fatalf("SelectionRange: got %d results, want 2", len(ranges))
+		}
+		// Each selection should start with the identifier under the cursor, and
+		// expand to enclose the whole return expression.
+		expr := env.RegexpSearch("a.go", `return (x \+ y\*2)`).Range
+		for i, loc := range []protocol.Location{x, y} {
+			sel := &ranges[i]
+			if sel.Range != loc.Range {
+				t.Errorf("SelectionRange[%d]: got innermost range %v, want %v", i, sel.Range, loc.Range)
+			}
+			found := false
+			for ; sel != nil; sel = sel.Parent {
+				if sel.Range == expr {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("SelectionRange[%d]: no enclosing range %v", i, expr)
+			}
+		}
+	})
+}
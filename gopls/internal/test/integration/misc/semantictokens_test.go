@@ -10,11 +10,16 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/tools/gopls/internal/protocol"
 	. "golang.org/x/tools/gopls/internal/test/integration"
 	"golang.org/x/tools/gopls/internal/test/integration/fake"
 )
 
+// ignoreTokenPos ignores token ranges, for tests that only care about the
+// sequence of tokens.
+var ignoreTokenPos = cmpopts.IgnoreFields(fake.SemanticToken{}, "Range")
+
 func TestBadURICrash_VSCodeIssue1498(t *testing.T) {
 	const src = `
 -- go.mod --
@@ -97,7 +102,7 @@ func Add[T int](target T, l []T) []T {
 			Diagnostics(env.AtRegexp("main.go", "for range")),
 		)
 		seen := env.SemanticTokensFull("main.go")
-		if x := cmp.Diff(want, seen); x != "" {
+		if x := cmp.Diff(want, seen, ignoreTokenPos); x != "" {
 			t.Errorf("Semantic tokens do not match (-want +got):\n%s", x)
 		}
 	})
@@ -187,7 +192,7 @@ func bar() {}
 	).Run(t, src, func(t *testing.T, env *Env) {
 		env.OpenFile("main.go")
 		seen := env.SemanticTokensFull("main.go")
-		if x := cmp.Diff(want, seen); x != "" {
+		if x := cmp.Diff(want, seen, ignoreTokenPos); x != "" {
 			t.Errorf("Semantic tokens do not match (-want +got):\n%s", x)
 		}
 	})
@@ -231,8 +236,166 @@ const bad = `
 	).Run(t, src, func(t *testing.T, env *Env) {
 		env.OpenFile("main.go")
 		seen := env.SemanticTokensFull("main.go")
-		if x := cmp.Diff(want, seen); x != "" {
+		if x := cmp.Diff(want, seen, ignoreTokenPos); x != "" {
+			t.Errorf("Semantic tokens do not match (-want +got):\n%s", x)
+		}
+	})
+}
+
+func TestSemanticTokenPositions(t *testing.T) {
+	src := `
+-- go.mod --
+module example.com
+
+go 1.19
+-- main.go --
+package foo
+
+func f(x int) int {
+	return x
+}
+
+var x = f(1)
+`
+	WithOptions(
+		Modes(Default),
+		Settings{"semanticTokens": true},
+	).Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		// The occurrences of x have different token types; find each one by
+		// range.
+		decl := env.RegexpSearch("main.go", `func f\((x)`).Range
+		param := env.RegexpSearch("main.go", `return (x)`).Range
+		global := env.RegexpSearch("main.go", `var (x)`).Range
+		want := map[protocol.Range]string{
+			decl:   "parameter",
+			param:  "parameter",
+			global: "variable",
+		}
+		for _, tok := range env.SemanticTokensFull("main.go") {
+			if typ, ok := want[tok.Range]; ok {
+				if tok.Token != "x" || tok.TokenType != typ {
+					t.Errorf("token at %v = %q (%s), want %q (%s)", tok.Range, tok.Token, tok.TokenType, "x", typ)
+				}
+				delete(want, tok.Range)
+			}
+		}
+		for rng, typ := range want {
+			t.Errorf("no %s token at %v", typ, rng)
+		}
+	})
+}
+
+// Token columns are UTF-16 code units, so identifiers following multi-byte
+// and astral characters must still be decoded correctly.
+func TestSemanticTokensNonASCII(t *testing.T) {
+	src := `
+-- go.mod --
+module example.com
+
+go 1.19
+-- main.go --
+package foo
+
+var emoji = "🎉"; var café = emoji
+
+func naïve(é int) int { return é }
+`
+	WithOptions(
+		Modes(Default),
+		Settings{"semanticTokens": true},
+	).Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		want := []struct {
+			re, token, typ string
+		}{
+			{`var (café)`, "café", "variable"},
+			{`café = (emoji)`, "emoji", "variable"},
+			{`func (naïve)`, "naïve", "function"},
+			{`return (é)`, "é", "parameter"},
+		}
+		toks := env.SemanticTokensFull("main.go")
+		for _, w := range want {
+			rng := env.RegexpSearch("main.go", w.re).Range
+			found := false
+			for _, tok := range toks {
+				if tok.Range == rng {
+					found = true
+					if tok.Token != w.token || tok.TokenType != w.typ {
+						t.Errorf("token at %v = %q (%s), want %q (%s)", rng, tok.Token, tok.TokenType, w.token, w.typ)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("no token at %v (%s)", rng, w.re)
+			}
+		}
+	})
+}
+
+func TestSemanticTokensOfType(t *testing.T) {
+	src := `
+-- go.mod --
+module example.com
+
+go 1.19
+-- main.go --
+package foo
+
+func f(x int) int {
+	for range []int{} {
+	}
+	return x
+}
+`
+	want := []fake.SemanticToken{
+		{Token: "package", TokenType: "keyword"},
+		{Token: "func", TokenType: "keyword"},
+		{Token: "for", TokenType: "keyword"},
+		{Token: "range", TokenType: "keyword"},
+		{Token: "return", TokenType: "keyword"},
+	}
+	WithOptions(
+		Modes(Default),
+		Settings{"semanticTokens": true},
+	).Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		seen := env.SemanticTokensFullOfType("main.go", "keyword")
+		if x := cmp.Diff(want, seen, ignoreTokenPos); x != "" {
 			t.Errorf("Semantic tokens do not match (-want +got):\n%s", x)
 		}
 	})
 }
+
+func TestSemanticTokensRangeConsistent(t *testing.T) {
+	src := `
+-- go.mod --
+module example.com
+
+go 1.19
+-- main.go --
+package foo
+
+import "fmt"
+
+// T is a type.
+type T[P any] struct {
+	f P
+}
+
+func (t *T[P]) m(x int) string {
+	const c = "c" // comment
+	for i := range []int{1, 2} {
+		x += i
+	}
+	return fmt.Sprint(t.f, c, x, 1.5)
+}
+`
+	WithOptions(
+		Modes(Default),
+		Settings{"semanticTokens": true},
+	).Run(t, src, func(t *testing.T, env *Env) {
+		env.OpenFile("main.go")
+		env.AssertRangeTokensConsistent("main.go")
+	})
+}
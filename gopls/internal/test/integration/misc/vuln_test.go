@@ -629,6 +629,30 @@ func TestRunGovulncheck_Expiry(t *testing.T) {
 	})
 }
 
+func TestRunVulncheckResult(t *testing.T) {
+	db, opts, err := vulnTestEnv(proxy1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Clean()
+
+	WithOptions(opts...).Run(t, workspace1, func(t *testing.T, env *Env) {
+		result := env.RunVulncheck(".")
+		if result.Mode != vulncheck.ModeGovulncheck {
+			t.Errorf("RunVulncheck: got mode %q, want %q", result.Mode, vulncheck.ModeGovulncheck)
+		}
+		found := false
+		for _, finding := range result.Findings {
+			if finding.OSV == "GO-2022-02" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("RunVulncheck: no finding for GO-2022-02 in %s", stringify(result.Findings))
+		}
+	})
+}
+
 func stringify(a interface{}) string {
 	data, _ := json.Marshal(a)
 	return string(data)
@@ -457,6 +457,61 @@ func g() {
 	})
 }
 
+// TestBrowseViews checks that the Editor's helpers for the web-based views
+// return the URL shown by the server.
+func TestBrowseViews(t *testing.T) {
+	const files = `
+-- go.mod --
+module example.com
+
+-- a/a.go --
+package a
+
+import "fmt"
+
+func f() {
+	fmt.Println("hello")
+}
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		loc := env.RegexpSearch("a/a.go", `fmt.Println\("hello"\)`)
+
+		url := env.AssemblyView(loc)
+		if !strings.HasPrefix(url, "http:") || !strings.Contains(url, "/assembly?") {
+			t.Errorf("AssemblyView: got URL %q, want an http URL of an assembly listing", url)
+		}
+
+		url = env.FreeSymbolsView(loc)
+		if !strings.HasPrefix(url, "http:") || !strings.Contains(url, "/freesymbols?") {
+			t.Errorf("FreeSymbolsView: got URL %q, want an http URL of a free symbols report", url)
+		}
+		checkMatch(t, true, get(t, url), `<li>import "<a .*'>fmt</a>" // for Println</li>`)
+	})
+}
+
+// TestFetchDoc checks that the Editor can fetch the documentation page shown
+// by the "Browse documentation" code action.
+func TestFetchDoc(t *testing.T) {
+	const files = `
+-- go.mod --
+module example.com
+go 1.19
+
+-- a/a.go --
+package a
+
+// Greet returns a greeting.
+func Greet() string { return "hello" }
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		doc := env.FetchDoc(env.RegexpSearch("a/a.go", "Greet"))
+		checkMatch(t, true, []byte(doc), `<h3 id='Greet'>func .*Greet`)
+		checkMatch(t, true, []byte(doc), `Greet returns a greeting.`)
+	})
+}
+
 // shownDocument returns the first shown document matching the URI prefix.
 // It may be nil.
 // As a side effect, it clears the list of accumulated shown documents.
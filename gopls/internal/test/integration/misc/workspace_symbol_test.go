@@ -102,6 +102,37 @@ const (
 	})
 }
 
+func TestWorkspaceSymbolMatchers(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.17
+-- a/a.go --
+package a
+
+func DoSomethingQuickly() {}
+`
+
+	Run(t, files, func(t *testing.T, env *Env) {
+		for _, test := range []struct {
+			matcher settings.SymbolMatcher
+			want    []string
+		}{
+			{settings.SymbolFuzzy, []string{"DoSomethingQuickly"}},
+			{settings.SymbolCaseSensitive, nil},
+		} {
+			var got []string
+			for _, info := range env.SymbolsWithMatcher(test.matcher, "doSomething") {
+				got = append(got, info.Name)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected %s Symbol(%q) result (-want +got):\n%s", test.matcher, "doSomething", diff)
+			}
+		}
+	})
+}
+
 func checkSymbols(env *Env, query string, want ...string) {
 	env.T.Helper()
 	var got []string
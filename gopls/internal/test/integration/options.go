@@ -104,6 +104,22 @@ func CapabilitiesJSON(capabilities []byte) RunOption {
 	})
 }
 
+// NoWorkspaceConfiguration configures the editor not to advertise support
+// for workspace/configuration requests.
+func NoWorkspaceConfiguration() RunOption {
+	return optionSetter(func(opts *runConfig) {
+		opts.editor.NoWorkspaceConfiguration = true
+	})
+}
+
+// PushConfiguration configures the editor to send its settings in
+// didChangeConfiguration notifications.
+func PushConfiguration() RunOption {
+	return optionSetter(func(opts *runConfig) {
+		opts.editor.PushConfiguration = true
+	})
+}
+
 // Settings sets user-provided configuration for the LSP server.
 //
 // As a special case, the env setting must not be provided via Settings: use
@@ -12,6 +12,7 @@ import (
 	"golang.org/x/tools/gopls/internal/util/bug"
 
 	"golang.org/x/tools/gopls/internal/protocol"
+	"golang.org/x/tools/gopls/internal/server"
 	"golang.org/x/tools/gopls/internal/test/integration/fake"
 )
 
@@ -65,6 +66,72 @@ func _() {
 	})
 }
 
+// Test that each watched file write results in exactly one
+// didChangeWatchedFiles notification, which has been delivered by the time
+// AwaitWatchedFilesDelivered returns.
+func TestWatchedFilesCount(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.14
+-- a/a.go --
+package a
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		env.AfterChange()
+		before := env.Editor.Stats().DidChangeWatchedFiles
+		for _, name := range []string{"a/b.go", "a/c.go", "a/d.go"} {
+			env.WriteWorkspaceFile(name, "package a")
+		}
+		env.AwaitWatchedFilesDelivered()
+		if got := env.Editor.Stats().DidChangeWatchedFiles - before; got != 3 {
+			t.Errorf("got %d didChangeWatchedFiles notifications, want 3", got)
+		}
+		env.AfterChange(
+			CompletedWork(server.DiagnosticWorkTitle(server.FromDidChangeWatchedFiles), before+3, false),
+		)
+	})
+}
+
+// Test that the editor tracks gopls's re-registration of file watchers when
+// the set of workspace folders changes, which registers the new watchers
+// before unregistering the old.
+func TestWatchRegistrationFollowsWorkspace(t *testing.T) {
+	const files = `
+-- a/go.mod --
+module a.com
+
+go 1.14
+-- a/a.go --
+package a
+-- b/go.mod --
+module b.com
+
+go 1.14
+-- b/b.go --
+package b
+`
+	WithOptions(
+		WorkspaceFolders("a"),
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OnceMet(
+			InitialWorkspaceLoad,
+			NoFileWatchMatching("/b/"),
+		)
+		if !env.Editor.IsRegistered("workspace/didChangeWatchedFiles") {
+			t.Fatal("file watching is not registered")
+		}
+
+		env.ChangeWorkspaceFolders("a", "b")
+		env.Await(FileWatchMatching("/b/"))
+		env.AfterChange()
+		if !env.Editor.IsRegistered("workspace/didChangeWatchedFiles") {
+			t.Fatal("file watching is not registered after changing workspace folders")
+		}
+	})
+}
+
 // Edit a dependency on disk and expect a new diagnostic.
 func TestEditDependency(t *testing.T) {
 	const pkg = `
@@ -1466,3 +1466,58 @@ func TestChangeNonFileWorkspaceFolders(t *testing.T) {
 		})
 	}
 }
+
+// Test that the view configuration reflects a GOOS/GOARCH override in the
+// environment.
+func TestViewConfigGOOS(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- a/a.go --
+package a
+`
+	WithOptions(
+		EnvVars{"GOOS": "plan9", "GOARCH": "arm"},
+	).Run(t, files, func(t *testing.T, env *Env) {
+		env.OpenFile("a/a.go")
+		view := env.ViewConfig("a/a.go")
+		if got, want := view.Root, env.Sandbox.Workdir.URI("."); got != want {
+			t.Errorf("ViewConfig(%q).Root = %v, want %v", "a/a.go", got, want)
+		}
+		if view.GOOS != "plan9" || view.GOARCH != "arm" {
+			t.Errorf("ViewConfig(%q) has GOOS=%s GOARCH=%s, want plan9/arm", "a/a.go", view.GOOS, view.GOARCH)
+		}
+	})
+}
+
+// Test that clearing the workspace folders removes the server's views, and
+// that clearing them again does not restore the default folder.
+func TestClearWorkspaceFolders(t *testing.T) {
+	const files = `
+-- go.mod --
+module mod.com
+
+go 1.18
+-- a/a.go --
+package a
+`
+	Run(t, files, func(t *testing.T, env *Env) {
+		if got, want := len(env.Views()), 1; got != want {
+			t.Fatalf("initially got %d views, want %d", got, want)
+		}
+		env.ClearWorkspaceFolders()
+		if got := env.Views(); len(got) != 0 {
+			t.Errorf("after clearing workspace folders, got views %v, want none", got)
+		}
+		env.ClearWorkspaceFolders()
+		if got := env.Views(); len(got) != 0 {
+			t.Errorf("after clearing workspace folders twice, got views %v, want none", got)
+		}
+		env.ChangeWorkspaceFolders(".")
+		if got, want := len(env.Views()), 1; got != want {
+			t.Errorf("after restoring the workspace folder, got %d views, want %d", got, want)
+		}
+	})
+}
@@ -9,10 +9,14 @@ import (
 	"errors"
 	"os"
 	"path"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/tools/gopls/internal/protocol"
 	"golang.org/x/tools/gopls/internal/protocol/command"
+	"golang.org/x/tools/gopls/internal/settings"
 	"golang.org/x/tools/gopls/internal/test/integration/fake"
+	"golang.org/x/tools/gopls/internal/vulncheck"
 	"golang.org/x/tools/internal/xcontext"
 )
 
@@ -73,6 +77,33 @@ func (e *Env) OpenFile(name string) {
 	}
 }
 
+// OpenFileReadOnly opens a file in the editor as a read-only buffer, calling
+// t.Fatal on any error.
+func (e *Env) OpenFileReadOnly(name string) {
+	e.T.Helper()
+	if err := e.Editor.OpenFileReadOnly(e.Ctx, name); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// OpenFileRaw writes the exact content to a file and opens it in the
+// editor, calling t.Fatal on any error.
+func (e *Env) OpenFileRaw(name, content string) {
+	e.T.Helper()
+	if err := e.Editor.OpenFileRaw(e.Ctx, name, content); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// ForceDidOpen sends a duplicate didOpen notification for an open buffer,
+// calling t.Fatal on any error.
+func (e *Env) ForceDidOpen(name string) {
+	e.T.Helper()
+	if err := e.Editor.ForceDidOpen(e.Ctx, name); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // CreateBuffer creates a buffer in the editor, calling t.Fatal on any error.
 func (e *Env) CreateBuffer(name string, content string) {
 	e.T.Helper()
@@ -101,6 +132,15 @@ func (e *Env) CloseBuffer(name string) {
 	}
 }
 
+// ForceDidClose sends a didClose notification for name, whether or not it is
+// open, calling t.Fatal on any error.
+func (e *Env) ForceDidClose(name string) {
+	e.T.Helper()
+	if err := e.Editor.ForceDidClose(e.Ctx, name); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // EditBuffer applies edits to an editor buffer, calling t.Fatal on any error.
 func (e *Env) EditBuffer(name string, edits ...protocol.TextEdit) {
 	e.T.Helper()
@@ -109,6 +149,24 @@ func (e *Env) EditBuffer(name string, edits ...protocol.TextEdit) {
 	}
 }
 
+// EditBufferIncremental applies edits to an editor buffer, sending each as a
+// separate incremental change. It calls t.Fatal on any error.
+func (e *Env) EditBufferIncremental(name string, edits ...protocol.TextEdit) {
+	e.T.Helper()
+	if err := e.Editor.EditBufferIncremental(e.Ctx, name, edits); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// EditBuffers applies edits to several editor buffers at once, calling
+// t.Fatal on any error.
+func (e *Env) EditBuffers(edits map[string][]protocol.TextEdit) {
+	e.T.Helper()
+	if err := e.Editor.EditBuffers(e.Ctx, edits); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 func (e *Env) SetBufferContent(name string, content string) {
 	e.T.Helper()
 	if err := e.Editor.SetBufferContent(e.Ctx, name, content); err != nil {
@@ -160,6 +218,15 @@ func (e *Env) RegexpReplace(name, regexpStr, replace string) {
 	}
 }
 
+// RegexpReplaceAll replaces every match of regexpStr in the named buffer
+// with the replace text, calling t.Fatal on any error.
+func (e *Env) RegexpReplaceAll(name, regexpStr, replace string) {
+	e.T.Helper()
+	if err := e.Editor.RegexpReplaceAll(e.Ctx, name, regexpStr, replace); err != nil {
+		e.T.Fatalf("RegexpReplaceAll: %v", err)
+	}
+}
+
 // SaveBuffer saves an editor buffer, calling t.Fatal on any error.
 func (e *Env) SaveBuffer(name string) {
 	e.T.Helper()
@@ -168,6 +235,15 @@ func (e *Env) SaveBuffer(name string) {
 	}
 }
 
+// EditAndSave applies edits to an editor buffer and saves it, calling
+// t.Fatal on any error.
+func (e *Env) EditAndSave(name string, edits []protocol.TextEdit) {
+	e.T.Helper()
+	if err := e.Editor.EditAndSave(e.Ctx, name, edits); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 func (e *Env) SaveBufferWithoutActions(name string) {
 	e.T.Helper()
 	if err := e.Editor.SaveBufferWithoutActions(e.Ctx, name); err != nil {
@@ -197,6 +273,16 @@ func (e *Env) TypeDefinition(loc protocol.Location) protocol.Location {
 	return loc
 }
 
+// Declarations wraps Editor.Declarations, calling t.Fatal on any error.
+func (e *Env) Declarations(loc protocol.Location) []protocol.Location {
+	e.T.Helper()
+	locs, err := e.Editor.Declarations(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return locs
+}
+
 // FormatBuffer formats the editor buffer, calling t.Fatal on any error.
 func (e *Env) FormatBuffer(name string) {
 	e.T.Helper()
@@ -205,6 +291,24 @@ func (e *Env) FormatBuffer(name string) {
 	}
 }
 
+// FormatBufferRange formats the given range of an editor buffer, calling
+// t.Fatal on any error.
+func (e *Env) FormatBufferRange(loc protocol.Location) {
+	e.T.Helper()
+	if err := e.Editor.FormatBufferRange(e.Ctx, loc); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// OnTypeFormat formats the buffer after typing ch at loc, calling t.Fatal on
+// any error.
+func (e *Env) OnTypeFormat(loc protocol.Location, ch string) {
+	e.T.Helper()
+	if err := e.Editor.OnTypeFormat(e.Ctx, loc, ch); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // OrganizeImports processes the source.organizeImports codeAction, calling
 // t.Fatal on any error.
 func (e *Env) OrganizeImports(name string) {
@@ -223,6 +327,24 @@ func (e *Env) ApplyQuickFixes(path string, diagnostics []protocol.Diagnostic) {
 	}
 }
 
+// ChangeSignature performs a "change signature" refactoring, calling t.Fatal
+// on any error.
+func (e *Env) ChangeSignature(args command.ChangeSignatureArgs) {
+	e.T.Helper()
+	if err := e.Editor.ChangeSignature(e.Ctx, args); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// GenerateTest generates a test for the function at loc, calling t.Fatal on
+// any error.
+func (e *Env) GenerateTest(loc protocol.Location) {
+	e.T.Helper()
+	if err := e.Editor.GenerateTest(e.Ctx, loc); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // ApplyCodeAction applies the given code action.
 func (e *Env) ApplyCodeAction(action protocol.CodeAction) {
 	e.T.Helper()
@@ -231,6 +353,25 @@ func (e *Env) ApplyCodeAction(action protocol.CodeAction) {
 	}
 }
 
+// PreviewCodeAction wraps Editor.PreviewCodeAction, calling t.Fatal on any
+// error.
+func (e *Env) PreviewCodeAction(loc protocol.Location, title string) *protocol.WorkspaceEdit {
+	e.T.Helper()
+	wsedit, err := e.Editor.PreviewCodeAction(e.Ctx, loc, title)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return wsedit
+}
+
+// ExtractFunction wraps Editor.ExtractFunction, calling t.Fatal on any error.
+func (e *Env) ExtractFunction(loc protocol.Location) {
+	e.T.Helper()
+	if err := e.Editor.ExtractFunction(e.Ctx, loc); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // GetQuickFixes returns the available quick fix code actions.
 func (e *Env) GetQuickFixes(path string, diagnostics []protocol.Diagnostic) []protocol.CodeAction {
 	e.T.Helper()
@@ -242,6 +383,17 @@ func (e *Env) GetQuickFixes(path string, diagnostics []protocol.Diagnostic) []pr
 	return actions
 }
 
+// PreferredQuickFix wraps Editor.PreferredQuickFix, calling t.Fatal on any
+// error.
+func (e *Env) PreferredQuickFix(loc protocol.Location, diagnostics []protocol.Diagnostic) *protocol.CodeAction {
+	e.T.Helper()
+	action, err := e.Editor.PreferredQuickFix(e.Ctx, loc, diagnostics)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return action
+}
+
 // Hover in the editor, calling t.Fatal on any error.
 // It may return (nil, zero) even on success.
 func (e *Env) Hover(loc protocol.Location) (*protocol.MarkupContent, protocol.Location) {
@@ -253,6 +405,17 @@ func (e *Env) Hover(loc protocol.Location) (*protocol.MarkupContent, protocol.Lo
 	return c, loc
 }
 
+// HoverImport hovers over the quoted import path importPath in the buffer at
+// path, calling t.Fatal on any error.
+func (e *Env) HoverImport(path, importPath string) *protocol.MarkupContent {
+	e.T.Helper()
+	c, err := e.Editor.HoverImport(e.Ctx, path, importPath)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return c
+}
+
 func (e *Env) DocumentLink(name string) []protocol.DocumentLink {
 	e.T.Helper()
 	links, err := e.Editor.DocumentLink(e.Ctx, name)
@@ -262,6 +425,37 @@ func (e *Env) DocumentLink(name string) []protocol.DocumentLink {
 	return links
 }
 
+// FoldingRange wraps Editor.FoldingRange, calling t.Fatal on any error.
+func (e *Env) FoldingRange(name string) []protocol.FoldingRange {
+	e.T.Helper()
+	ranges, err := e.Editor.FoldingRange(e.Ctx, name)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return ranges
+}
+
+// ImportFoldingRange wraps Editor.ImportFoldingRange, calling t.Fatal on any
+// error.
+func (e *Env) ImportFoldingRange(name string) *protocol.FoldingRange {
+	e.T.Helper()
+	rng, err := e.Editor.ImportFoldingRange(e.Ctx, name)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return rng
+}
+
+// DocumentSymbols wraps Editor.DocumentSymbols, calling t.Fatal on any error.
+func (e *Env) DocumentSymbols(name string) []protocol.DocumentSymbol {
+	e.T.Helper()
+	symbols, err := e.Editor.DocumentSymbols(e.Ctx, name)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return symbols
+}
+
 func (e *Env) DocumentHighlight(loc protocol.Location) []protocol.DocumentHighlight {
 	e.T.Helper()
 	highlights, err := e.Editor.DocumentHighlight(e.Ctx, loc)
@@ -271,6 +465,37 @@ func (e *Env) DocumentHighlight(loc protocol.Location) []protocol.DocumentHighli
 	return highlights
 }
 
+// DocumentColor wraps Editor.DocumentColor, calling t.Fatal on any error.
+func (e *Env) DocumentColor(path string) []protocol.ColorInformation {
+	e.T.Helper()
+	colors, err := e.Editor.DocumentColor(e.Ctx, path)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return colors
+}
+
+// ColorPresentation wraps Editor.ColorPresentation, calling t.Fatal on any
+// error.
+func (e *Env) ColorPresentation(loc protocol.Location, color protocol.Color) []protocol.ColorPresentation {
+	e.T.Helper()
+	presentations, err := e.Editor.ColorPresentation(e.Ctx, loc, color)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return presentations
+}
+
+// Moniker wraps Editor.Moniker, calling t.Fatal on any error.
+func (e *Env) Moniker(loc protocol.Location) []protocol.Moniker {
+	e.T.Helper()
+	monikers, err := e.Editor.Moniker(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return monikers
+}
+
 // RunGenerate runs "go generate" in the given dir, calling t.Fatal on any error.
 // It waits for the generate command to complete and checks for file changes
 // before returning.
@@ -337,6 +562,208 @@ func (e *Env) DumpGoSum(dir string) {
 	e.T.Fatal("see contents above")
 }
 
+// AwaitDiagnosticsCleared waits for the server to publish an empty set of
+// diagnostics for the file at the given workdir-relative path. It calls
+// t.Fatal on any error.
+func (e *Env) AwaitDiagnosticsCleared(path string) {
+	e.T.Helper()
+	if err := e.Editor.AwaitDiagnosticsCleared(e.Ctx, path); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// AwaitDiagnosticsFor wraps Editor.AwaitDiagnosticsFor, calling t.Fatal on
+// any error.
+func (e *Env) AwaitDiagnosticsFor(paths ...string) map[string][]protocol.Diagnostic {
+	e.T.Helper()
+	diags, err := e.Editor.AwaitDiagnosticsFor(e.Ctx, paths)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return diags
+}
+
+// AwaitPublishedDiagnostics wraps Editor.AwaitPublishedDiagnostics, calling
+// t.Fatal on any error.
+func (e *Env) AwaitPublishedDiagnostics(path string, version int) []protocol.Diagnostic {
+	e.T.Helper()
+	diags, err := e.Editor.AwaitPublishedDiagnostics(e.Ctx, path, version)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return diags
+}
+
+// AssemblyView executes the "Browse assembly" code action at loc, and returns
+// the URL of the resulting assembly listing. It calls t.Fatal on any error.
+func (e *Env) AssemblyView(loc protocol.Location) string {
+	e.T.Helper()
+	url, err := e.Editor.AssemblyView(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return url
+}
+
+// FreeSymbolsView executes the "Browse free symbols" code action at loc, and
+// returns the URL of the resulting report. It calls t.Fatal on any error.
+func (e *Env) FreeSymbolsView(loc protocol.Location) string {
+	e.T.Helper()
+	url, err := e.Editor.FreeSymbolsView(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return url
+}
+
+// FetchDoc wraps Editor.FetchDoc, calling t.Fatal on any error.
+func (e *Env) FetchDoc(loc protocol.Location) string {
+	e.T.Helper()
+	doc, err := e.Editor.FetchDoc(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return doc
+}
+
+// AwaitWatchedFilesDelivered waits until all didChangeWatchedFiles
+// notifications counted by the editor have been sent to the server. It calls
+// t.Fatal on any error.
+func (e *Env) AwaitWatchedFilesDelivered() {
+	e.T.Helper()
+	if err := e.Editor.AwaitWatchedFilesDelivered(e.Ctx); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// PrepareCallHierarchy returns the call hierarchy items for the symbol at loc,
+// opening its file if necessary. It calls t.Fatal on any error.
+func (e *Env) PrepareCallHierarchy(loc protocol.Location) []protocol.CallHierarchyItem {
+	e.T.Helper()
+	items, err := e.Editor.PrepareCallHierarchy(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return items
+}
+
+// PrepareCallHierarchyBatch returns the call hierarchy items for the symbol
+// at each of locs, calling t.Fatal on any error.
+func (e *Env) PrepareCallHierarchyBatch(locs ...protocol.Location) map[protocol.Location][]protocol.CallHierarchyItem {
+	e.T.Helper()
+	items, err := e.Editor.PrepareCallHierarchyBatch(e.Ctx, locs)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return items
+}
+
+// IncomingCalls returns the calls to the given call hierarchy item. It calls
+// t.Fatal on any error.
+func (e *Env) IncomingCalls(item protocol.CallHierarchyItem) []protocol.CallHierarchyIncomingCall {
+	e.T.Helper()
+	calls, err := e.Editor.IncomingCalls(e.Ctx, item)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return calls
+}
+
+// OutgoingCalls returns the calls made by the given call hierarchy item. It
+// calls t.Fatal on any error.
+func (e *Env) OutgoingCalls(item protocol.CallHierarchyItem) []protocol.CallHierarchyOutgoingCall {
+	e.T.Helper()
+	calls, err := e.Editor.OutgoingCalls(e.Ctx, item)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return calls
+}
+
+// ToggleCompilerOptDetails toggles the compiler optimization details
+// diagnostics for the package in the given workdir-relative directory. It
+// calls t.Fatal on any error.
+func (e *Env) ToggleCompilerOptDetails(dir string) {
+	e.T.Helper()
+	if err := e.Editor.ToggleCompilerOptDetails(e.Ctx, dir); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// ResetGoModDiagnostics resets the resettable diagnostics of the go.mod file
+// at the given workdir-relative path. It calls t.Fatal on any error.
+func (e *Env) ResetGoModDiagnostics(path string) {
+	e.T.Helper()
+	if err := e.Editor.ResetGoModDiagnostics(e.Ctx, path); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// RegenerateCgo regenerates the cgo definitions of the package containing the
+// file at the given workdir-relative path. It calls t.Fatal on any error.
+func (e *Env) RegenerateCgo(path string) {
+	e.T.Helper()
+	if err := e.Editor.RegenerateCgo(e.Ctx, path); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// RunVulncheck wraps Editor.RunVulncheck, calling t.Fatal on any error.
+func (e *Env) RunVulncheck(dir string) *vulncheck.Result {
+	e.T.Helper()
+	result, err := e.Editor.RunVulncheck(e.Ctx, dir)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return result
+}
+
+// AwaitProgressToken wraps Editor.AwaitProgressToken, calling t.Fatal on any
+// error.
+func (e *Env) AwaitProgressToken(title string) protocol.ProgressToken {
+	e.T.Helper()
+	token, err := e.Editor.AwaitProgressToken(e.Ctx, title)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return token
+}
+
+// AwaitProgress wraps Editor.AwaitProgress, calling t.Fatal on any error.
+func (e *Env) AwaitProgress(titlePattern string) {
+	e.T.Helper()
+	if err := e.Editor.AwaitProgress(e.Ctx, titlePattern); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// CancelProgress wraps Editor.CancelProgress, calling t.Fatal on any error.
+func (e *Env) CancelProgress(token protocol.ProgressToken) {
+	e.T.Helper()
+	if err := e.Editor.CancelProgress(e.Ctx, token); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// ListKnownPackages wraps Editor.ListKnownPackages, calling t.Fatal on any
+// error.
+func (e *Env) ListKnownPackages(path string) []string {
+	e.T.Helper()
+	pkgs, err := e.Editor.ListKnownPackages(e.Ctx, path)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return pkgs
+}
+
+// AddImport wraps Editor.AddImport, calling t.Fatal on any error.
+func (e *Env) AddImport(path, importPath string) {
+	e.T.Helper()
+	if err := e.Editor.AddImport(e.Ctx, path, importPath); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // CheckForFileChanges triggers a manual poll of the workspace for any file
 // changes since creation, or since last polling. It is a workaround for the
 // lack of true file watching support in the fake workspace.
@@ -358,6 +785,18 @@ func (e *Env) CodeLens(path string) []protocol.CodeLens {
 	return lens
 }
 
+// CodeLensAt calls textDocument/codeLens for the given path, and returns the
+// lenses whose range starts on the given (0-based) line. It calls t.Fatal on
+// any error.
+func (e *Env) CodeLensAt(path string, line uint32) []protocol.CodeLens {
+	e.T.Helper()
+	lens, err := e.Editor.CodeLensAt(e.Ctx, path, line)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return lens
+}
+
 // ExecuteCodeLensCommand executes the command for the code lens matching the
 // given command name.
 func (e *Env) ExecuteCodeLensCommand(path string, cmd command.Command, result interface{}) {
@@ -366,6 +805,17 @@ func (e *Env) ExecuteCodeLensCommand(path string, cmd command.Command, result in
 	var lens protocol.CodeLens
 	var found bool
 	for _, l := range lenses {
+		if l.Command == nil {
+			// The server defers the command to codeLens/resolve.
+			resolved, err := e.Editor.ResolveCodeLens(e.Ctx, l)
+			if err != nil {
+				e.T.Fatal(err)
+			}
+			if resolved == nil || resolved.Command == nil {
+				continue
+			}
+			l = *resolved
+		}
 		if l.Command.Command == cmd.String() {
 			lens = l
 			found = true
@@ -418,6 +868,26 @@ func (e *Env) Views() []command.View {
 	return summaries
 }
 
+// StartDebugging wraps Editor.StartDebugging, calling t.Fatal on any error.
+func (e *Env) StartDebugging() string {
+	e.T.Helper()
+	url, err := e.Editor.StartDebugging(e.Ctx)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return url
+}
+
+// ViewConfig wraps Editor.ViewConfig, calling t.Fatal on any error.
+func (e *Env) ViewConfig(path string) *fake.ViewConfig {
+	e.T.Helper()
+	config, err := e.Editor.ViewConfig(e.Ctx, path)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return config
+}
+
 // StartProfile starts a CPU profile with the given name, using the
 // gopls.start_profile custom command. It calls t.Fatal on any error.
 //
@@ -474,6 +944,17 @@ func (e *Env) Symbol(query string) []protocol.SymbolInformation {
 	return ans
 }
 
+// SymbolsWithMatcher wraps Editor.SymbolsWithMatcher, calling t.Fatal on any
+// error.
+func (e *Env) SymbolsWithMatcher(matcher settings.SymbolMatcher, query string) []protocol.SymbolInformation {
+	e.T.Helper()
+	ans, err := e.Editor.SymbolsWithMatcher(e.Ctx, matcher, query)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return ans
+}
+
 // References wraps Editor.References, calling t.Fatal on any error.
 func (e *Env) References(loc protocol.Location) []protocol.Location {
 	e.T.Helper()
@@ -484,6 +965,36 @@ func (e *Env) References(loc protocol.Location) []protocol.Location {
 	return locations
 }
 
+// ReferencesStreaming wraps Editor.ReferencesStreaming, calling t.Fatal on
+// any error.
+func (e *Env) ReferencesStreaming(loc protocol.Location, onChunk func([]protocol.Location)) {
+	e.T.Helper()
+	if err := e.Editor.ReferencesStreaming(e.Ctx, loc, onChunk); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// PrepareRename wraps Editor.PrepareRename, calling t.Fatal on any error.
+func (e *Env) PrepareRename(loc protocol.Location) *protocol.PrepareRenameResult {
+	e.T.Helper()
+	res, err := e.Editor.PrepareRename(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return res
+}
+
+// RenameReturningEdit wraps Editor.RenameReturningEdit, calling t.Fatal on
+// any error.
+func (e *Env) RenameReturningEdit(loc protocol.Location, newName string) *protocol.WorkspaceEdit {
+	e.T.Helper()
+	wsedit, err := e.Editor.RenameReturningEdit(e.Ctx, loc, newName)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return wsedit
+}
+
 // Rename wraps Editor.Rename, calling t.Fatal on any error.
 func (e *Env) Rename(loc protocol.Location, newName string) {
 	e.T.Helper()
@@ -492,6 +1003,15 @@ func (e *Env) Rename(loc protocol.Location, newName string) {
 	}
 }
 
+// RenameWithPlaceholderCheck wraps Editor.RenameWithPlaceholderCheck,
+// calling t.Fatal on any error.
+func (e *Env) RenameWithPlaceholderCheck(loc protocol.Location, newName, wantPlaceholder string) {
+	e.T.Helper()
+	if err := e.Editor.RenameWithPlaceholderCheck(e.Ctx, loc, newName, wantPlaceholder); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // Implementations wraps Editor.Implementations, calling t.Fatal on any error.
 func (e *Env) Implementations(loc protocol.Location) []protocol.Location {
 	e.T.Helper()
@@ -530,6 +1050,28 @@ func (e *Env) Completion(loc protocol.Location) *protocol.CompletionList {
 	return completions
 }
 
+// CompletionWithBudget wraps Editor.CompletionWithBudget, calling t.Fatal on
+// any error.
+func (e *Env) CompletionWithBudget(loc protocol.Location, budget time.Duration) *protocol.CompletionList {
+	e.T.Helper()
+	completions, err := e.Editor.CompletionWithBudget(e.Ctx, loc, budget)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return completions
+}
+
+// DeprecatedCompletions wraps Editor.DeprecatedCompletions, calling t.Fatal
+// on any error.
+func (e *Env) DeprecatedCompletions(loc protocol.Location) []protocol.CompletionItem {
+	e.T.Helper()
+	items, err := e.Editor.DeprecatedCompletions(e.Ctx, loc)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return items
+}
+
 func (e *Env) SetSuggestionInsertReplaceMode(useReplaceMode bool) {
 	e.T.Helper()
 	e.Editor.SetSuggestionInsertReplaceMode(e.Ctx, useReplaceMode)
@@ -561,6 +1103,17 @@ func (e *Env) CodeAction(loc protocol.Location, diagnostics []protocol.Diagnosti
 	return actions
 }
 
+// CodeActionsOfKind wraps Editor.CodeActionsOfKind, calling t.Fatal on any
+// error.
+func (e *Env) CodeActionsOfKind(loc protocol.Location, kind protocol.CodeActionKind) []protocol.CodeAction {
+	e.T.Helper()
+	actions, err := e.Editor.CodeActionsOfKind(e.Ctx, loc, kind)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return actions
+}
+
 // ChangeConfiguration updates the editor config, calling t.Fatal on any error.
 func (e *Env) ChangeConfiguration(newConfig fake.EditorConfig) {
 	e.T.Helper()
@@ -569,6 +1122,15 @@ func (e *Env) ChangeConfiguration(newConfig fake.EditorConfig) {
 	}
 }
 
+// SetAnalyzerEnabled enables or disables the named analyzer, calling t.Fatal
+// on any error.
+func (e *Env) SetAnalyzerEnabled(name string, enabled bool) {
+	e.T.Helper()
+	if err := e.Editor.SetAnalyzerEnabled(e.Ctx, name, enabled); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
 // ChangeWorkspaceFolders updates the editor workspace folders, calling t.Fatal
 // on any error.
 func (e *Env) ChangeWorkspaceFolders(newFolders ...string) {
@@ -578,6 +1140,25 @@ func (e *Env) ChangeWorkspaceFolders(newFolders ...string) {
 	}
 }
 
+// ClearWorkspaceFolders removes all editor workspace folders, calling t.Fatal
+// on any error.
+func (e *Env) ClearWorkspaceFolders() {
+	e.T.Helper()
+	if err := e.Editor.ClearWorkspaceFolders(e.Ctx); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// SelectionRange wraps Editor.SelectionRange, calling t.Fatal on any error.
+func (e *Env) SelectionRange(loc protocol.Location, more ...protocol.Location) []protocol.SelectionRange {
+	e.T.Helper()
+	ranges, err := e.Editor.SelectionRange(e.Ctx, loc, more...)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return ranges
+}
+
 // SemanticTokensFull invokes textDocument/semanticTokens/full, calling t.Fatal
 // on any error.
 func (e *Env) SemanticTokensFull(path string) []fake.SemanticToken {
@@ -589,6 +1170,17 @@ func (e *Env) SemanticTokensFull(path string) []fake.SemanticToken {
 	return toks
 }
 
+// SemanticTokensFullOfType invokes textDocument/semanticTokens/full and
+// returns only the tokens of the given types, calling t.Fatal on any error.
+func (e *Env) SemanticTokensFullOfType(path string, types ...string) []fake.SemanticToken {
+	e.T.Helper()
+	toks, err := e.Editor.SemanticTokensFullOfType(e.Ctx, path, types...)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return toks
+}
+
 // SemanticTokensRange invokes textDocument/semanticTokens/range, calling t.Fatal
 // on any error.
 func (e *Env) SemanticTokensRange(loc protocol.Location) []fake.SemanticToken {
@@ -600,6 +1192,20 @@ func (e *Env) SemanticTokensRange(loc protocol.Location) []fake.SemanticToken {
 	return toks
 }
 
+// AssertRangeTokensConsistent checks that range semantic tokens over the
+// whole file at path match the full semantic tokens, calling t.Error on any
+// discrepancy and t.Fatal on any other error.
+func (e *Env) AssertRangeTokensConsistent(path string) {
+	e.T.Helper()
+	full, rng, err := e.Editor.SemanticTokensFullAndRange(e.Ctx, path)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	if diff := cmp.Diff(full, rng); diff != "" {
+		e.T.Errorf("semantic tokens of %s: range tokens differ from full tokens (-full +range):\n%s", path, diff)
+	}
+}
+
 // Close shuts down the editor session and cleans up the sandbox directory,
 // calling t.Error on any error.
 func (e *Env) Close() {